@@ -0,0 +1,63 @@
+package main
+
+import "fmt"
+
+// Bank switching lets a program use an image bigger than memory. The image is laid out as if
+// it were loaded at 0x200 into a memory as large as itself. The lower half of memory always
+// holds the start of it, 0x200-0x7FF, and everything after that is split into 2KB banks, one
+// after another, that 01NN maps into the upper half of memory. So bank 0 is the rest of the
+// image that fits in memory, at 0x600 in the file, bank 1 the next 2KB at 0xE00, and so on.
+// Code that switches banks should run from the lower half.
+const (
+	bankSize      = 0x800
+	bankedAddress = 0x800
+)
+
+// loadBanks sets up the banks from the start of the image, which is already in memory, and
+// whatever didn't fit.
+func (c *Chip8) loadBanks(overflow []byte) {
+	size := len(c.memory) + len(overflow)
+	if (size-bankedAddress)%bankSize != 0 {
+		size += bankSize - (size-bankedAddress)%bankSize
+	}
+	c.image = make([]byte, size)
+	copy(c.image, c.memory[:])
+	copy(c.image[len(c.memory):], overflow)
+	c.bank = 0
+}
+
+// Banks returns the number of banks the loaded image is split into.
+func (c *Chip8) Banks() int {
+	if c.image == nil {
+		return 1
+	}
+	return (len(c.image) - bankedAddress) / bankSize
+}
+
+// switchBank maps bank n into the upper half of memory, first saving anything the program
+// wrote to the current bank so it's still there if it's switched back.
+func (c *Chip8) switchBank(n int) error {
+	if n >= c.Banks() {
+		return fmt.Errorf("bank %d is out of range, the image has %d", n, c.Banks())
+	}
+	if c.image == nil {
+		// A single bank is always mapped
+		return nil
+	}
+
+	c.recordBank()
+	c.mapBank(n)
+	return nil
+}
+
+// mapBank does the work of switchBank, without checking n or logging the switch for undo.
+func (c *Chip8) mapBank(n int) {
+	copy(c.image[c.bankOffset(c.bank):c.bankOffset(c.bank+1)], c.memory[bankedAddress:])
+	copy(c.memory[bankedAddress:], c.image[c.bankOffset(n):c.bankOffset(n+1)])
+	c.bank = n
+}
+
+// bankOffset is where bank n starts in the image.
+func (c *Chip8) bankOffset(n int) int {
+	return bankedAddress + n*bankSize
+}
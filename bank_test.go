@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestBankSwitchingMapsWholeImage(t *testing.T) {
+	// An 8KB image, which is 0x600 bytes that always stay in memory and then 3 banks. Each
+	// byte holds the low half of its offset in the file, mixed with the high half.
+	rom := make([]byte, 0x2000-0x200)
+	for i := range rom {
+		rom[i] = byte(i) ^ byte(i>>8)
+	}
+	copy(rom, []byte{0x01, 0x01, 0x01, 0x02, 0x01, 0x00})
+
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Keypad = nil
+	c.BankSwitching = true
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	if c.Banks() != 3 {
+		t.Fatalf("%d banks, want 3", c.Banks())
+	}
+
+	seen := make([]bool, len(rom))
+	check := func(bank int) {
+		t.Helper()
+		for addr := 0x200; addr < len(c.memory); addr++ {
+			offset := addr - 0x200
+			if addr >= bankedAddress {
+				offset += bank * bankSize
+			}
+			if c.memory[addr] != rom[offset] {
+				t.Fatalf("bank %d: 0x%03X holds 0x%02X, want file byte 0x%04X, 0x%02X", bank, addr, c.memory[addr], offset, rom[offset])
+			}
+			seen[offset] = true
+		}
+	}
+
+	check(0)
+	for _, bank := range []int{1, 2, 0} {
+		step(t, c, 1)
+		if c.bank != bank {
+			t.Fatalf("bank %d mapped, want %d", c.bank, bank)
+		}
+		check(bank)
+	}
+	for offset, ok := range seen {
+		if !ok {
+			t.Fatalf("file byte 0x%04X never appeared in memory", offset)
+		}
+	}
+}
+
+func TestBankSwitchingKeepsWrites(t *testing.T) {
+	// Write 0xAA to 0x900 in bank 0, switch to bank 1 and back, and read it back
+	rom := make([]byte, 0x2000-0x200)
+	copy(rom, []byte{
+		0xA9, 0x00, // LD I, 0x900
+		0x60, 0xAA, // LD V0, 0xAA
+		0xF0, 0x55, // LD [I], V0
+		0x01, 0x01, // bank 1
+		0x01, 0x00, // bank 0
+		0x60, 0x00, // LD V0, 0x00
+		0xF0, 0x65, // LD V0, [I]
+	})
+
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Keypad = nil
+	c.BankSwitching = true
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	step(t, c, 4)
+	if c.memory[0x900] == 0xAA {
+		t.Fatalf("0x900 still holds the write to bank 0 with bank 1 mapped")
+	}
+	step(t, c, 3)
+	if c.V[0] != 0xAA {
+		t.Errorf("0x900 holds 0x%02X after switching back to bank 0, want 0xAA", c.V[0])
+	}
+	if err := c.switchBank(3); err == nil {
+		t.Errorf("switching to bank 3 of 3 returned no error")
+	}
+}
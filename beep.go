@@ -0,0 +1,45 @@
+package main
+
+import "github.com/nsf/termbox-go"
+
+// beepIndicator returns the character the Config.ShowBeep indicator shows, a note while the
+// sound timer is running and a blank otherwise.
+func beepIndicator(soundTimer uint8) rune {
+	if soundTimer > 0 {
+		return '♪'
+	}
+	return ' '
+}
+
+// updateBeep flags a render when the beep indicator needs to be lit or put out.
+func (c *Chip8) updateBeep() {
+	if !c.ShowBeep {
+		return
+	}
+	if on := beepIndicator(c.soundTimer) != ' '; on != c.beepShown {
+		c.beepShown = on
+		c.drawFlag = true
+	}
+}
+
+// updateSound starts the renderer's tone when the sound timer is set, and stops it once the
+// timer runs out or the machine is paused or stopped.
+func (c *Chip8) updateSound() {
+	on := c.soundTimer > 0 && !c.Paused && !c.Stopped()
+	if on == c.sounding {
+		return
+	}
+	c.sounding = on
+	if c.Renderer != nil {
+		c.Renderer.Beep(on)
+	}
+}
+
+// drawBeep draws the beep indicator ch at (x, y), if it fits in the terminal.
+func drawBeep(x, y int, ch rune) {
+	termWidth, termHeight := termbox.Size()
+	if x >= termWidth || y >= termHeight {
+		return
+	}
+	termbox.SetCell(x, y, ch, termbox.ColorDefault, termbox.ColorDefault)
+}
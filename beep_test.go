@@ -0,0 +1,84 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBeepStartsAndStopsWithSoundTimer(t *testing.T) {
+	// LD V0, 3; LD ST, V0; then spin
+	c := newTestChip8(t, 0x60, 0x03, 0xF0, 0x18, 0x12, 0x04)
+	r := &HeadlessRenderer{}
+	c.Renderer = r
+
+	step(t, c, 2)
+	if !reflect.DeepEqual(r.Beeps, []bool{true}) {
+		t.Fatalf("beeps %v after setting the sound timer, want the tone started", r.Beeps)
+	}
+	runFrames(t, c, 2)
+	if !reflect.DeepEqual(r.Beeps, []bool{true}) {
+		t.Fatalf("beeps %v with the sound timer at %d, want the tone still going", r.Beeps, c.soundTimer)
+	}
+	runFrames(t, c, 2)
+	if !reflect.DeepEqual(r.Beeps, []bool{true, false}) {
+		t.Errorf("beeps %v once the sound timer ran out, want the tone started and stopped", r.Beeps)
+	}
+}
+
+func TestBeepStopsWhilePaused(t *testing.T) {
+	c := newTestChip8(t, 0x60, 0x30, 0xF0, 0x18, 0x12, 0x04)
+	r := &HeadlessRenderer{}
+	c.Renderer = r
+
+	step(t, c, 2)
+	c.Pause()
+	c.cycle()
+	c.Resume()
+	c.cycle()
+	if !reflect.DeepEqual(r.Beeps, []bool{true, false, true}) {
+		t.Errorf("beeps %v pausing and resuming, want the tone stopped while paused", r.Beeps)
+	}
+}
+
+func TestMinSoundTimer(t *testing.T) {
+	for _, tt := range []struct {
+		value byte
+		beeps bool
+	}{{1, false}, {2, true}, {3, true}} {
+		// LD V0, value; LD ST, V0
+		c := newTestChip8(t, 0x60, tt.value, 0xF0, 0x18)
+		r := &HeadlessRenderer{}
+		c.Renderer = r
+		c.MinSoundTimer = 2
+		step(t, c, 2)
+		if got := len(r.Beeps) > 0; got != tt.beeps {
+			t.Errorf("sound timer set to %d with a minimum of 2: beeped %v, want %v", tt.value, got, tt.beeps)
+		}
+	}
+}
+
+func TestBeepIndicator(t *testing.T) {
+	for _, tt := range []struct {
+		soundTimer uint8
+		want       rune
+	}{{0, ' '}, {1, '♪'}, {255, '♪'}} {
+		if got := beepIndicator(tt.soundTimer); got != tt.want {
+			t.Errorf("beepIndicator(%d) = %q, want %q", tt.soundTimer, got, tt.want)
+		}
+	}
+
+	// The indicator is redrawn as it comes on and goes off
+	c := newTestChip8(t)
+	c.ShowBeep = true
+	for _, tt := range []struct {
+		soundTimer uint8
+		redraw     bool
+	}{{2, true}, {1, false}, {0, true}, {0, false}} {
+		c.soundTimer = tt.soundTimer
+		c.updateBeep()
+		if c.ShouldDraw() != tt.redraw {
+			t.Errorf("sound timer %d: redraw %v, want %v", tt.soundTimer, c.ShouldDraw(), tt.redraw)
+		}
+		c.ClearDrawFlag()
+	}
+}
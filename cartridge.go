@@ -0,0 +1,81 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// LoadCartridge loads a ROM bundled in a zip archive along with its settings. The archive must
+// hold exactly one ROM, and may also hold a .cfg file in the format read by ParseConfig, which
+// is applied before the ROM is loaded. Any file that isn't a .cfg is taken to be the ROM.
+func (c *Chip8) LoadCartridge(r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("cartridge: %v", err)
+	}
+
+	var romFile, cfgFile *zip.File
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		if strings.EqualFold(path.Ext(f.Name), ".cfg") {
+			if cfgFile != nil {
+				return fmt.Errorf("cartridge: more than one config file, %s and %s", cfgFile.Name, f.Name)
+			}
+			cfgFile = f
+			continue
+		}
+		if romFile != nil {
+			return fmt.Errorf("cartridge: more than one ROM, %s and %s", romFile.Name, f.Name)
+		}
+		romFile = f
+	}
+	if romFile == nil {
+		return fmt.Errorf("cartridge: no ROM found")
+	}
+
+	rom, err := readZipFile(romFile)
+	if err != nil {
+		return err
+	}
+	if meta, program, ok := ParseOctoMetadata(rom); ok {
+		meta.Apply(&c.Config)
+		rom = program
+	}
+
+	if cfgFile != nil {
+		cfg, err := readZipFile(cfgFile)
+		if err != nil {
+			return err
+		}
+		if err := ParseConfig(bytes.NewReader(cfg), &c.Config); err != nil {
+			return fmt.Errorf("cartridge: %s: %v", cfgFile.Name, err)
+		}
+	}
+
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		return fmt.Errorf("cartridge: %s: %v", romFile.Name, err)
+	}
+	c.Name = path.Base(romFile.Name)
+	return nil
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("cartridge: %s: %v", f.Name, err)
+	}
+	defer rc.Close()
+
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("cartridge: %s: %v", f.Name, err)
+	}
+	return data, nil
+}
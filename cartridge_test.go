@@ -0,0 +1,64 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"testing"
+)
+
+// buildCartridge zips up files, by name.
+func buildCartridge(t *testing.T, files map[string]string) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, data := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestLoadCartridge(t *testing.T) {
+	cart := buildCartridge(t, map[string]string{
+		"games/pong.ch8": "\x60\x42\x12\x02",
+		"pong.cfg":       "clock_hz = 900\naccuracy = vip\n",
+	})
+	c := newTestChip8(t)
+	if err := c.LoadCartridge(cart, cart.Size()); err != nil {
+		t.Fatal(err)
+	}
+	if c.ClockHz != 900 || c.Accuracy != AccuracyVIP || !c.Quirks.DisplayWait {
+		t.Errorf("clock %d with accuracy %v, want the config's 900 and vip", c.ClockHz, c.Accuracy)
+	}
+	if c.Name != "pong.ch8" {
+		t.Errorf("name %q, want pong.ch8", c.Name)
+	}
+	step(t, c, 1)
+	if c.V[0] != 0x42 {
+		t.Errorf("V0 = 0x%02X, want the ROM to have run", c.V[0])
+	}
+}
+
+func TestLoadCartridgeErrors(t *testing.T) {
+	for name, files := range map[string]map[string]string{
+		"no ROM":     {"game.cfg": "clock_hz = 900\n"},
+		"two ROMs":   {"a.ch8": "\x12\x00", "b.ch8": "\x12\x00"},
+		"bad config": {"a.ch8": "\x12\x00", "a.cfg": "clock_hz = fast\n"},
+	} {
+		cart := buildCartridge(t, files)
+		if err := newTestChip8(t).LoadCartridge(cart, cart.Size()); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if err := newTestChip8(t).LoadCartridge(bytes.NewReader([]byte("not a zip")), 9); err == nil {
+		t.Error("not a zip: no error")
+	}
+}
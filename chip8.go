@@ -1,17 +1,22 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log"
 	"math/rand"
-	"os"
+	"sync/atomic"
 	"time"
+)
 
-	"github.com/nsf/termbox-go"
-
-	"azul3d.org/engine/keyboard"
+// Display sizes for the standard and SCHIP high resolution modes
+const (
+	lowResWidth  = 64
+	lowResHeight = 32
+	hiResWidth   = 128
+	hiResHeight  = 64
 )
 
 var Chip8Fontset = [80]byte{
@@ -34,27 +39,145 @@ var Chip8Fontset = [80]byte{
 }
 
 type Chip8 struct {
+	Config
+
 	opcode uint16
 	I      uint16
 	pc     uint16
 	memory [4096]byte
+	// rom is the game as it was last loaded and where it was loaded, for Reset
+	rom         []byte
+	loadAddress uint16
+	// romHash identifies the loaded ROM, see rplStore
+	romHash string
+	// rplStore holds the SCHIP RPL user flags of each ROM, keyed by romHash. They're meant to
+	// be non-volatile, so Initialize leaves them alone and they can be saved with SaveRPL.
+	rplStore map[string][16]byte
+	// With Config.BankSwitching, image holds the whole ROM image and bank is the one mapped in
+	image []byte
+	bank  int
 
 	V        [16]byte
-	gfx      [2048]byte // 64 x 32
+	gfx      [hiResWidth * hiResHeight]byte // Width() x Height(), one byte per pixel
+	hires    bool
 	drawFlag bool
+	// displayDirty is set if the last instruction changed the display, see DisplayDirty
+	displayDirty bool
 
 	stack [16]uint16
 	sp    uint16
+	// The subroutine address called by each stack entry, for debuggers
+	callTargets [16]uint16
 
 	delayTimer uint8
-	soundTimer uint8
-
-	keys       [16]bool
-	keyWatcher *keyboard.Watcher
+	// lastDelayTimer is the delay timer as it was before its last update, see
+	// Quirks.DelayTimerLatency
+	lastDelayTimer uint8
+	soundTimer     uint8
+	// beepShown is whether the Config.ShowBeep indicator was last drawn lit
+	beepShown bool
+	// sounding is whether the renderer was last told to play the tone
+	sounding bool
+
+	keys     [16]bool
+	prevKeys [16]bool
+	// Keypad supplies the key state, it defaults to reading the terminal through termbox
+	Keypad Keypad
+	// Renderer shows the display and plays the sound, it defaults to the terminal through
+	// termbox. Nil runs without either, leaving it to the caller to draw, see ShouldDraw.
+	Renderer Renderer
+
+	// halted is set once the program jumps to itself, or exits with 00FD, and so can make no
+	// further progress
+	halted bool
+
+	// Paused stops execution, including the timers, until it's cleared again, see Pause and
+	// Resume. It's also set when a breakpoint is hit.
+	Paused bool
+	// stopped is set by Stop, and read and written atomically as it's meant to be set from
+	// another goroutine
+	stopped int32
+	// requests holds the functions queued by Do for Run to call
+	requests chan func(*Chip8)
+
+	// executed records every address an instruction has been fetched from
+	executed [4096]bool
+	// selfModWarned holds the addresses already reported by the TrapSelfModify check
+	selfModWarned map[uint16]bool
+	// spriteWarned holds the sprite addresses already reported by the TrapSpriteOverread check
+	spriteWarned map[uint16]bool
+
+	breakpoints  map[uint16]bool
+	opcodeBreaks []opcodeBreak
+
+	// The callbacks set by WatchRegister and WatchMemory. watchingRegisters is set if there
+	// are any register watches, so there's no need to check for changes otherwise.
+	registerWatches   [16][]func(old, new byte)
+	watchingRegisters bool
+	memoryWatches     map[uint16][]func(old, new byte)
+
+	// undoLog has a record of the changes made by each recent instruction, see Config.UndoDepth
+	undoLog []*undoRecord
+	// trace has the most recent instructions, see Config.TraceDepth
+	trace traceRing
+
+	// fault is the error that paused the machine, with Config.PauseOnError
+	fault error
+	// skipBreak lets the instruction a breakpoint stopped on run once emulation resumes
+	skipBreak bool
+
+	// Log receives diagnostic warnings about the running ROM. Nil discards them.
+	Log *log.Logger
+	// Tracer, if set, is called with each instruction just before it executes, for logging
+	// everything a program does. See WriterTracer.
+	Tracer func(pc, opcode uint16, mnemonic string)
+
+	cycles            int
+	drewThisFrame     bool
+	framesWithoutDraw int
+	// For Config.DelayWaitWarnFrames, the zero reads of the delay timer this frame, whether
+	// it's run at all this frame, and the frames in a row it's been spun on
+	delayZeroReads  int
+	delayRunning    bool
+	delaySpinFrames int
+	// waitingForFrame idles the CPU until the next frame, see Quirks.DisplayWait
+	waitingForFrame bool
+
+	playlist *playlist
+
+	// Name is shown in the status line, it's normally the ROM's file name
+	Name      string
+	stats     frameStats
+	drawStats DrawStats
+
+	// When the next cycle is due, and for Config.MaxFrameSkip how many renders in a row have
+	// been skipped
+	nextCycle     time.Time
+	skippedFrames int
+	// lastRender is when the terminal was last flushed, for Config.RefreshHz
+	lastRender time.Time
+
+	// RandomSource, if set, supplies the bytes CXNN uses in place of random numbers, one per
+	// instruction. It's meant for tests that need exact results.
+	RandomSource io.Reader
+	// Rand supplies CXNN's random numbers otherwise. NewChip8 seeds it from the clock, give it
+	// a fixed seed to reproduce a run.
+	Rand *rand.Rand
+
+	recording *Demo
+	replay    *replayState
 }
 
 func NewChip8() *Chip8 {
-	return &Chip8{}
+	c := &Chip8{
+		Config: DefaultConfig(),
+		Keypad: NewTermboxKeypad(),
+		Rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+		// Enough that a burst of key presses never holds up the event loop
+		requests: make(chan func(*Chip8), 16),
+	}
+	c.Renderer = NewTermboxRenderer(c)
+	return c
 }
 
 func (c *Chip8) Initialize() {
@@ -63,432 +186,1195 @@ func (c *Chip8) Initialize() {
 	c.sp = 0
 	c.pc = 0x200 // 512
 	c.memory = [4096]byte{}
+	c.image = nil
+	c.bank = 0
 	c.V = [16]byte{}
-	c.gfx = [2048]byte{}
+	c.gfx = [len(c.gfx)]byte{}
+	c.hires = false
 	c.stack = [16]uint16{}
+	c.callTargets = [16]uint16{}
 	c.delayTimer = 0
+	c.lastDelayTimer = 0
 	c.soundTimer = 0
 	c.keys = [16]bool{}
-	c.keyWatcher = keyboard.NewWatcher()
+	c.prevKeys = [16]bool{}
+	c.halted = false
+	c.fault = nil
+	c.undoLog = nil
+	c.trace = traceRing{}
+	c.drawStats = DrawStats{}
+	c.executed = [4096]bool{}
+	c.selfModWarned = nil
+	c.spriteWarned = nil
 	c.drawFlag = true
+	c.displayDirty = false
+	c.cycles = 0
+	c.drewThisFrame = false
+	c.framesWithoutDraw = 0
+	c.delayZeroReads = 0
+	c.delayRunning = false
+	c.delaySpinFrames = 0
+	c.waitingForFrame = false
 
 	// Load fontset into the first 80 addresses of memory
+	fontset := c.Font.Fontset()
 	for i := 0; i < 80; i++ {
-		c.memory[i] = Chip8Fontset[i]
+		c.memory[i] = fontset[i]
+	}
+	copy(c.memory[largeFontAddress:], largeFontset[:])
+}
+
+func (c *Chip8) LoadGame(r io.Reader) error {
+	return c.loadGameAt(r, 0x200)
+}
+
+// LoadGameBytes loads rom in the same way as LoadGame, for ROMs that are already in memory,
+// such as ones embedded with go:embed.
+func (c *Chip8) LoadGameBytes(rom []byte) error {
+	return c.LoadGame(bytes.NewReader(rom))
+}
+
+// loadGameAt loads the game into memory from start, and starts execution there. Memory is
+// left alone if the ROM can't be read or doesn't fit.
+func (c *Chip8) loadGameAt(r io.Reader, start uint16) error {
+	rom, err := io.ReadAll(r)
+	if err != nil {
+		return fmt.Errorf("error reading rom: %v", err)
+	}
+	if room := len(c.memory) - int(start); len(rom) > room && !c.BankSwitching {
+		return fmt.Errorf("rom is %d bytes, the most that fits in memory is %d", len(rom), room)
+	}
+
+	n := copy(c.memory[start:], rom)
+	if c.BankSwitching {
+		c.loadBanks(rom[n:])
+	}
+	c.rom = rom
+	c.loadAddress = start
+	c.pc = start
+	c.romHash = romHash(c.rom)
+	return nil
+}
+
+// Reset restarts the loaded game from the beginning, as if the machine had been switched off
+// and on again with the same ROM in it.
+func (c *Chip8) Reset() {
+	rom, start := c.rom, c.loadAddress
+	c.Initialize()
+	// The ROM was loaded from here before, so it's sure to fit again
+	c.loadGameAt(bytes.NewReader(rom), start)
+}
+
+// LoadGameAuto loads rom at the address it looks like it was written for, either 0x200 like
+// most programs or 0x600 like those for the ETI-660, and returns the address used. The guess
+// is based on which address puts more of the ROM's jump and call targets inside the ROM
+// itself, with the first instruction counting double as it's usually a jump to the start of
+// the program. Anything ambiguous is loaded at 0x200.
+func (c *Chip8) LoadGameAuto(rom []byte) (uint16, error) {
+	start := uint16(0x200)
+	if loadAddressScore(rom, 0x600) > loadAddressScore(rom, 0x200) && 0x600+len(rom) <= len(c.memory) {
+		start = 0x600
 	}
+	return start, c.loadGameAt(bytes.NewReader(rom), start)
 }
 
-func (c *Chip8) LoadGame(buf *bufio.Reader) {
-	i := 0x200 // 512
-	for {
-		b, err := buf.ReadByte()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			panic(err)
+// loadAddressScore counts the jumps and calls in rom that land inside it if it's loaded at start.
+func loadAddressScore(rom []byte, start int) int {
+	score := 0
+	for i := 0; i+1 < len(rom); i += 2 {
+		opcode := uint16(rom[i])<<8 | uint16(rom[i+1])
+		if opcode&0xF000 != 0x1000 && opcode&0xF000 != 0x2000 {
+			continue
+		}
+		if target := int(opcode & 0x0FFF); target >= start && target < start+len(rom) {
+			score++
+			if i == 0 {
+				score++
+			}
 		}
-		c.memory[i] = b
-		i++
 	}
+	return score
 }
 
-func (c *Chip8) fetchOpcode() uint16 {
+func (c *Chip8) fetchOpcode() (uint16, error) {
+	if int(c.pc)+1 >= len(c.memory) {
+		return 0, PCOutOfRangeError(c.pc)
+	}
 	// Merge the bytes at the current program counter and the one after it.
-	return binary.BigEndian.Uint16([]byte{c.memory[c.pc], c.memory[c.pc+1]})
+	return binary.BigEndian.Uint16([]byte{c.memory[c.pc], c.memory[c.pc+1]}), nil
 }
 
-func (c *Chip8) decodeOpcode(opcode uint16) {
-	// Just look at the first 4 bytes of the opcode first
-	switch opcode & 0xF000 {
-	// There are two cases here so switch between them
-	case 0x0000:
-		switch opcode & 0x000F {
-		// 00E0: Clears the screen
-		case 0x0000:
-			c.gfx = [2048]byte{}
-			c.drawFlag = true
-			c.pc += 2
-
-		// 00EE: Return from a subroutine
-		case 0x000E:
-			// I think to return from a subroutine we need to go back up the program stack?
-			// And increment by 2 like normal
-			c.sp--
-			c.pc = c.stack[c.sp] + 2
-
-		default:
-			panic(fmt.Sprintf("Unknown opcode: 0x%X", opcode))
-		}
+// opcodeHandler runs a single instruction.
+type opcodeHandler func(c *Chip8, opcode uint16) error
 
-	// 1NNN: Jumps to address NNN
-	case 0x1000:
-		c.pc = opcode & 0x0FFF
-		// Don't increment the program counter as we've just jumped!
-
-	// 2NNN: Calls subroutine at NNN
-	case 0x2000:
-		// temp jump to NNN, so store the current address in the stack first
-		c.stack[c.sp] = c.pc
-		c.sp++
-		c.pc = opcode & 0x0FFF
-		// Don't increment the program counter as we've just jumped!
-
-	// 3XNN: Skips the next instruction if VX equals NN. (Usually the next instruction is a jump to skip a code block)
-	case 0x3000:
-		if c.V[(opcode&0x0F00)>>8] == byte(opcode&0x00FF) {
-			// Skip the next instruction
-			c.pc += 2
-		}
-		c.pc += 2
+// opcodeTable holds the handler for each first digit of an opcode. Where several instructions
+// share a first digit, the handler looks the rest of the opcode up in one of the tables below.
+var opcodeTable = [16]opcodeHandler{
+	op0Group, op1NNN, op2NNN, op3XNN, op4XNN, op5XY0, op6XNN, op7XNN,
+	op8Group, op9XY0, opANNN, opBNNN, opCXNN, opDXYN, opEGroup, opFGroup,
+}
 
-	// 4XNN: Skips the next instruction if VX doesn't equal NN. (Usually the next instruction is a jump to skip a code block)
-	case 0x4000:
-		if c.V[(opcode&0x0F00)>>8] != byte(opcode&0x00FF) {
-			// Skip the next instruction
-			c.pc += 2
+// schip marks h as a SUPER-CHIP instruction, which is unknown without the SCHIPInstructions
+// quirk.
+func schip(h opcodeHandler) opcodeHandler {
+	return func(c *Chip8, opcode uint16) error {
+		if !c.Quirks.SCHIPInstructions {
+			return unknownOpcodeError(opcode)
 		}
-		c.pc += 2
+		return h(c, opcode)
+	}
+}
 
-	// 5XY0: Skips the next instruction if VX equals VY. (Usually the next instruction is a jump to skip a code block)
-	case 0x5000:
-		if c.V[(opcode&0x0F00)>>8] == c.V[(opcode&0x00F0)>>4] {
-			// Skip the next instruction
-			c.pc += 2
-		}
+// sysOpcodes holds the 00NN instructions by their last byte, apart from 00CN, which takes
+// an argument.
+var sysOpcodes = [256]opcodeHandler{
+	0xE0: op00E0,
+	0xEE: op00EE,
+	0xFB: schip(op00FB),
+	0xFC: schip(op00FC),
+	0xFD: schip(op00FD),
+	0xFE: schip(op00FE),
+	0xFF: schip(op00FF),
+}
+
+// aluOpcodes holds the 8XYN instructions by their last digit.
+var aluOpcodes = [16]opcodeHandler{
+	0x0: op8XY0,
+	0x1: op8XY1,
+	0x2: op8XY2,
+	0x3: op8XY3,
+	0x4: op8XY4,
+	0x5: op8XY5,
+	0x6: op8XY6,
+	0x7: op8XY7,
+	0xE: op8XYE,
+}
+
+// keyOpcodes holds the EXNN instructions by their last byte.
+var keyOpcodes = [256]opcodeHandler{
+	0x9E: opEX9E,
+	0xA1: opEXA1,
+}
+
+// miscOpcodes holds the FXNN instructions by their last byte.
+var miscOpcodes = [256]opcodeHandler{
+	0x07: opFX07,
+	0x0A: opFX0A,
+	0x15: opFX15,
+	0x18: opFX18,
+	0x1E: opFX1E,
+	0x29: opFX29,
+	0x30: schip(opFX30),
+	0x33: opFX33,
+	0x55: opFX55,
+	0x65: opFX65,
+	0x75: schip(opFX75),
+	0x85: schip(opFX85),
+}
+
+func (c *Chip8) decodeOpcode(opcode uint16) error {
+	// Just look at the first 4 bits of the opcode first
+	return opcodeTable[opcode>>12](c, opcode)
+}
+
+// dispatch runs the handler at table[i], or reports opcode as unknown if there isn't one.
+func dispatch(table []opcodeHandler, i uint16, c *Chip8, opcode uint16) error {
+	if h := table[i]; h != nil {
+		return h(c, opcode)
+	}
+	return unknownOpcodeError(opcode)
+}
+
+// Several opcodes share this prefix so look them up by the last byte
+func op0Group(c *Chip8, opcode uint16) error {
+	switch {
+	case c.BankSwitching && opcode&0x0F00 == 0x0100:
+		return op01NN(c, opcode)
+	case c.Quirks.SCHIPInstructions && opcode&0xFFF0 == 0x00C0:
+		return op00CN(c, opcode)
+	case opcode&0xFF00 == 0:
+		return dispatch(sysOpcodes[:], opcode&0x00FF, c, opcode)
+	}
+	return unknownOpcodeError(opcode)
+}
+
+func op8Group(c *Chip8, opcode uint16) error {
+	return dispatch(aluOpcodes[:], opcode&0x000F, c, opcode)
+}
+
+func opEGroup(c *Chip8, opcode uint16) error {
+	return dispatch(keyOpcodes[:], opcode&0x00FF, c, opcode)
+}
+
+func opFGroup(c *Chip8, opcode uint16) error {
+	return dispatch(miscOpcodes[:], opcode&0x00FF, c, opcode)
+}
+
+// 01NN: Maps bank NN into the upper half of memory, see Config.BankSwitching
+func op01NN(c *Chip8, opcode uint16) error {
+	if err := c.switchBank(int(opcode & 0x00FF)); err != nil {
+		return err
+	}
+	c.pc += 2
+	return nil
+}
+
+// 00CN: Scrolls the display down N pixels (SCHIP)
+func op00CN(c *Chip8, opcode uint16) error {
+	c.scrollDown(int(opcode & 0x000F))
+	c.pc += 2
+	return nil
+}
+
+// 00E0: Clears the screen
+func op00E0(c *Chip8, opcode uint16) error {
+	c.recordDisplay()
+	c.gfx = [len(c.gfx)]byte{}
+	c.drawStats.clear()
+	c.redraw()
+	c.pc += 2
+	return nil
+}
+
+// 00EE: Return from a subroutine
+func op00EE(c *Chip8, opcode uint16) error {
+	if c.sp == 0 {
+		return fmt.Errorf("stack underflow: return at 0x%03X with an empty stack", c.pc)
+	}
+	c.sp--
+	c.pc = c.stack[c.sp]
+	return nil
+}
+
+// 00FB: Scrolls the display right 4 pixels (SCHIP)
+func op00FB(c *Chip8, opcode uint16) error {
+	c.scrollRight(4)
+	c.pc += 2
+	return nil
+}
+
+// 00FC: Scrolls the display left 4 pixels (SCHIP)
+func op00FC(c *Chip8, opcode uint16) error {
+	c.scrollRight(-4)
+	c.pc += 2
+	return nil
+}
+
+// 00FD: Exits the interpreter (SCHIP). pc stays on the 00FD, so the machine halts here
+// just as it would on a jump to itself.
+func op00FD(c *Chip8, opcode uint16) error {
+	c.halted = true
+	return nil
+}
+
+// 00FE: Disable high resolution mode (SCHIP)
+func op00FE(c *Chip8, opcode uint16) error {
+	c.setHiRes(false)
+	c.pc += 2
+	return nil
+}
+
+// 00FF: Enable high resolution mode (SCHIP)
+func op00FF(c *Chip8, opcode uint16) error {
+	c.setHiRes(true)
+	c.pc += 2
+	return nil
+}
+
+// 1NNN: Jumps to address NNN
+func op1NNN(c *Chip8, opcode uint16) error {
+	// A jump to itself is how most programs finish, as there's no halt instruction
+	if opcode&0x0FFF == c.pc {
+		c.halted = true
+	}
+	c.pc = opcode & 0x0FFF
+	// Don't increment the program counter as we've just jumped!
+	return nil
+}
+
+// 2NNN: Calls subroutine at NNN
+func op2NNN(c *Chip8, opcode uint16) error {
+	// temp jump to NNN, so store the return address, the instruction after this one, in the
+	// stack first
+	if int(c.sp) == len(c.stack) {
+		return fmt.Errorf("stack overflow: call at 0x%03X with %d calls already on the stack", c.pc, c.sp)
+	}
+	c.stack[c.sp] = c.pc + 2
+	c.callTargets[c.sp] = opcode & 0x0FFF
+	c.sp++
+	c.pc = opcode & 0x0FFF
+	// Don't increment the program counter as we've just jumped!
+	return nil
+}
+
+// 3XNN: Skips the next instruction if VX equals NN. (Usually the next instruction is a jump to skip a code block)
+func op3XNN(c *Chip8, opcode uint16) error {
+	if c.V[(opcode&0x0F00)>>8] == byte(opcode&0x00FF) {
+		// Skip the next instruction
 		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-	// 6XNN: Sets VX to NN.
-	case 0x6000:
-		c.V[(opcode&0x0F00)>>8] = byte(opcode & 0x00FF)
+// 4XNN: Skips the next instruction if VX doesn't equal NN. (Usually the next instruction is a jump to skip a code block)
+func op4XNN(c *Chip8, opcode uint16) error {
+	if c.V[(opcode&0x0F00)>>8] != byte(opcode&0x00FF) {
+		// Skip the next instruction
 		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-	// 7XNN: Adds NN to VX. (Carry flag is not changed)
-	case 0x7000:
-		c.V[(opcode&0x0F00)>>8] += byte(opcode & 0x00FF)
+// 5XY0: Skips the next instruction if VX equals VY. (Usually the next instruction is a jump to skip a code block)
+func op5XY0(c *Chip8, opcode uint16) error {
+	if opcode&0x000F != 0 {
+		return unknownOpcodeError(opcode)
+	}
+	if c.V[(opcode&0x0F00)>>8] == c.V[(opcode&0x00F0)>>4] {
+		// Skip the next instruction
 		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-	case 0x8000:
-		switch opcode & 0x000F {
-		// 8XY0: Sets VX to the value of VY.
-		case 0x0000:
-			c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x00F0)>>4]
-			c.pc += 2
-
-		// 8XY1: Sets VX to VX or VY. (Bitwise OR operation)
-		case 0x0001:
-			c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] | c.V[(opcode&0x00F0)>>4]
-			c.pc += 2
-
-		// 8XY2: Sets VX to VX and VY. (Bitwise AND operation)
-		case 0x0002:
-			c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] & c.V[(opcode&0x00F0)>>4]
-			c.pc += 2
-
-		// 8XY3: Sets VX to VX xor VY.
-		case 0x0003:
-			c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] ^ c.V[(opcode&0x00F0)>>4]
-			c.pc += 2
-
-		// 8XY4: Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there isn't.
-		case 0x0004:
-			// Explanation on Opcode Example 2 here http://www.multigesture.net/articles/how-to-write-an-emulator-chip-8-interpreter/
-			if c.V[(opcode&0x00F0)>>4] > (0xFF - c.V[(opcode&0x0F00)>>8]) {
-				c.V[0xF] = 1 //carry
-			} else {
-				c.V[0xF] = 0
-			}
-			c.V[(opcode&0x0F00)>>8] += c.V[(opcode&0x00F0)>>4]
-			c.pc += 2
-
-		// 8XY5: VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
-		case 0x0005:
-			vx := c.V[(opcode&0x0F00)>>8]
-			vy := c.V[(opcode&0x00F0)>>4]
-			if vx-vy < 0 {
-				c.V[0xF] = 1 // borrow
-			} else {
-				c.V[0xF] = 0
-			}
-			c.V[(opcode&0x0F00)>>8] = vx - vy
-			c.pc += 2
-
-		// 8XY6: Stores the least significant bit of VX in VF and then shifts VX to the right by 1.
-		case 0x0006:
-			c.V[0xF] = c.V[(opcode&0x0F00)>>8] & 0x0000000F
-			c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] >> 1
-			c.pc += 2
-
-		// 8XY7: Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
-		case 0x0007:
-			vx := c.V[(opcode&0x0F00)>>8]
-			vy := c.V[(opcode&0x00F0)>>4]
-			if vy-vx < 0 {
-				c.V[0xF] = 0 // borrow
-			} else {
-				c.V[0xF] = 1
-			}
-			c.V[(opcode&0x00F0)>>4] = vy - vx
-			c.pc += 2
+// 6XNN: Sets VX to NN.
+func op6XNN(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] = byte(opcode & 0x00FF)
+	c.pc += 2
+	return nil
+}
 
-		// 8XYE: Stores the most significant bit of VX in VF and then shifts VX to the left by 1.
-		case 0x000E:
-			c.V[0xF] = c.V[(opcode&0x0F00)>>8] >> 7
-			c.V[(opcode&0x0F00)>>8] <<= 1
-			c.pc += 2
+// 7XNN: Adds NN to VX. (Carry flag is not changed)
+func op7XNN(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] += byte(opcode & 0x00FF)
+	c.pc += 2
+	return nil
+}
 
-		default:
-			panic(fmt.Sprintf("Unknown opcode: 0x%X", opcode))
-		}
+// 8XY0: Sets VX to the value of VY.
+func op8XY0(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x00F0)>>4]
+	c.pc += 2
+	return nil
+}
 
-	// 9XY0: Skips the next instruction if VX doesn't equal VY. (Usually the next instruction is a jump to skip a code block)
-	case 0x9000:
-		if c.V[(opcode&0x0F00)>>8] != c.V[(opcode&0x00F0)>>4] {
-			c.pc += 2
-		}
-		c.pc += 2
+// 8XY1: Sets VX to VX or VY. (Bitwise OR operation)
+func op8XY1(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] | c.V[(opcode&0x00F0)>>4]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
+	c.pc += 2
+	return nil
+}
 
-	// ANNN: Sets i to the address NNN
-	case 0xA000:
-		c.I = opcode & 0x0FFF
-		c.pc += 2
+// 8XY2: Sets VX to VX and VY. (Bitwise AND operation)
+func op8XY2(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] & c.V[(opcode&0x00F0)>>4]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
+	c.pc += 2
+	return nil
+}
 
-	// BNNN: Jumps to the address NNN plus V0.
-	case 0xB000:
-		c.pc = (opcode & 0x0FFF) + uint16(c.V[0])
-		// Don't increment the program counter as we've just jumped
+// 8XY3: Sets VX to VX xor VY.
+func op8XY3(c *Chip8, opcode uint16) error {
+	c.V[(opcode&0x0F00)>>8] = c.V[(opcode&0x0F00)>>8] ^ c.V[(opcode&0x00F0)>>4]
+	if c.Quirks.LogicResetsVF {
+		c.V[0xF] = 0
+	}
+	c.pc += 2
+	return nil
+}
 
-	// CXNN: Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
-	case 0xC000:
-		r := byte(rand.Intn(256))
-		c.V[(opcode&0x0F00)>>8] = r & byte(opcode&0x00FF)
+// 8XY4: Adds VY to VX. VF is set to 1 when there's a carry, and to 0 when there isn't.
+//
+// In this and the other arithmetic opcodes below, the flag is written after the result,
+// so when X is F, VF ends up holding the flag.
+func op8XY4(c *Chip8, opcode uint16) error {
+	vx := c.V[(opcode&0x0F00)>>8]
+	vy := c.V[(opcode&0x00F0)>>4]
+	// Explanation on Opcode Example 2 here http://www.multigesture.net/articles/how-to-write-an-emulator-chip-8-interpreter/
+	carry := byte(0)
+	if vy > 0xFF-vx {
+		carry = 1
+	}
+	c.V[(opcode&0x0F00)>>8] = vx + vy
+	c.V[0xF] = carry
+	c.pc += 2
+	return nil
+}
+
+// 8XY5: VY is subtracted from VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
+func op8XY5(c *Chip8, opcode uint16) error {
+	vx := c.V[(opcode&0x0F00)>>8]
+	vy := c.V[(opcode&0x00F0)>>4]
+	// The registers are unsigned, so check for the borrow before subtracting
+	noBorrow := byte(0)
+	if vx >= vy {
+		noBorrow = 1
+	}
+	c.V[(opcode&0x0F00)>>8] = vx - vy
+	c.V[0xF] = noBorrow
+	c.pc += 2
+	return nil
+}
+
+// 8XY6: Stores the least significant bit of VX in VF and then shifts VX to the right by 1.
+// With the ShiftUsesVY quirk, VY is shifted into VX instead.
+func op8XY6(c *Chip8, opcode uint16) error {
+	v := c.V[(opcode&0x0F00)>>8]
+	if c.Quirks.ShiftUsesVY {
+		v = c.V[(opcode&0x00F0)>>4]
+	}
+	c.V[(opcode&0x0F00)>>8] = v >> 1
+	c.V[0xF] = v & 0x01
+	c.pc += 2
+	return nil
+}
+
+// 8XY7: Sets VX to VY minus VX. VF is set to 0 when there's a borrow, and 1 when there isn't.
+func op8XY7(c *Chip8, opcode uint16) error {
+	vx := c.V[(opcode&0x0F00)>>8]
+	vy := c.V[(opcode&0x00F0)>>4]
+	noBorrow := byte(0)
+	if vy >= vx {
+		noBorrow = 1
+	}
+	c.V[(opcode&0x0F00)>>8] = vy - vx
+	c.V[0xF] = noBorrow
+	c.pc += 2
+	return nil
+}
+
+// 8XYE: Stores the most significant bit of VX in VF and then shifts VX to the left by 1.
+// With the ShiftUsesVY quirk, VY is shifted into VX instead.
+func op8XYE(c *Chip8, opcode uint16) error {
+	v := c.V[(opcode&0x0F00)>>8]
+	if c.Quirks.ShiftUsesVY {
+		v = c.V[(opcode&0x00F0)>>4]
+	}
+	c.V[(opcode&0x0F00)>>8] = v << 1
+	c.V[0xF] = v >> 7
+	c.pc += 2
+	return nil
+}
+
+// 9XY0: Skips the next instruction if VX doesn't equal VY. (Usually the next instruction is a jump to skip a code block)
+func op9XY0(c *Chip8, opcode uint16) error {
+	if opcode&0x000F != 0 {
+		return unknownOpcodeError(opcode)
+	}
+	if c.V[(opcode&0x0F00)>>8] != c.V[(opcode&0x00F0)>>4] {
 		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-	// DXYN: Draws a sprite at coordinate (VX, VY) that has a width of 8 pixels and a height of N pixels.
-	// Each row of 8 pixels is read as bit-coded starting from memory location I; I value doesn’t change
-	// after the execution of this instruction. As described above, VF is set to 1 if any screen pixels
-	// are flipped from set to unset when the sprite is drawn, and to 0 if that doesn’t happen
-	case 0xD000:
-		x := c.V[(opcode&0x0F00)>>8]
-		y := c.V[(opcode&0x00F0)>>4]
-		height := opcode & 0x000F
+// ANNN: Sets i to the address NNN
+func opANNN(c *Chip8, opcode uint16) error {
+	c.I = opcode & 0x0FFF
+	c.pc += 2
+	return nil
+}
 
-		// First reset VF
-		c.V[0xF] = 0
-		idx := uint16(0)
-		defer func() {
-			if r := recover(); r != nil {
-				panic(fmt.Sprintf("attempted to access index %v. x %v, y %v, height %v", idx, x, y, height))
+// BNNN: Jumps to the address NNN plus V0. With the JumpUsesVX quirk it's BXNN, jumping to
+// XNN plus VX.
+func opBNNN(c *Chip8, opcode uint16) error {
+	offset := c.V[0]
+	if c.Quirks.JumpUsesVX {
+		offset = c.V[(opcode&0x0F00)>>8]
+	}
+	c.pc = (opcode & 0x0FFF) + uint16(offset)
+	// Don't increment the program counter as we've just jumped
+	return nil
+}
+
+// CXNN: Sets VX to the result of a bitwise and operation on a random number (Typically: 0 to 255) and NN.
+func opCXNN(c *Chip8, opcode uint16) error {
+	r, err := c.random()
+	if err != nil {
+		return err
+	}
+	c.V[(opcode&0x0F00)>>8] = r & byte(opcode&0x00FF)
+	c.pc += 2
+	return nil
+}
+
+// DXYN: Draws a sprite at coordinate (VX, VY) that has a width of 8 pixels and a height of N pixels.
+// Each row of 8 pixels is read as bit-coded starting from memory location I; I value doesn’t change
+// after the execution of this instruction. As described above, VF is set to 1 if any screen pixels
+// are flipped from set to unset when the sprite is drawn, and to 0 if that doesn’t happen
+//
+// Sprite rows are always read straight out of memory at I, with no special casing for the font
+// region. Pointing I at 0x000-0x04F (e.g. via FX29) draws the font glyph stored there, exactly as
+// the original interpreter did.
+func opDXYN(c *Chip8, opcode uint16) error {
+	x := c.V[(opcode&0x0F00)>>8]
+	y := c.V[(opcode&0x00F0)>>4]
+	height := opcode & 0x000F
+
+	// DXY0 is a 16x16 sprite in SCHIP hi-res, stored as two bytes per row. Anywhere else
+	// it's zero rows high and the loop below draws nothing.
+	spriteWidth, rowBytes := uint16(8), uint16(1)
+	if height == 0 && c.hires && c.Quirks.LargeSprites {
+		height, spriteWidth, rowBytes = 16, 16, 2
+	}
+	size := height * rowBytes
+
+	if int(c.I)+int(size) > len(c.memory) {
+		return fmt.Errorf("sprite at 0x%03X with height %d reads past the end of memory", c.I, height)
+	}
+	if c.TrapSpriteOverread {
+		c.checkSpriteRead(size)
+	}
+
+	// First reset VF
+	c.V[0xF] = 0
+	c.drawStats.DrawsSinceClear++
+	c.redraw()
+
+	// The sprite always starts on screen, with the coordinates wrapping around. Any of it
+	// that then runs off the edge is either clipped or, with Config.WrapSprites, wrapped
+	// around to the other side.
+	width, screenHeight := uint16(c.Width()), uint16(c.Height())
+	left, top := uint16(x)%width, uint16(y)%screenHeight
+	screen := c.gfx[:width*screenHeight]
+	for yline := uint16(0); yline < height; yline++ {
+		py := top + yline
+		if py >= screenHeight {
+			if !c.WrapSprites {
+				break
 			}
-		}()
-
-		for yline := uint16(0); yline < height; yline++ {
-			pixel := c.memory[c.I+yline]
-			for xline := uint16(0); xline < 8; xline++ {
-				if pixel&(0x80>>xline) != 0 {
-					idx = uint16(x) + xline + ((uint16(y) + yline) * 64)
-					if c.gfx[idx] == 1 {
-						c.V[0xF] = 1
+			py %= screenHeight
+		}
+
+		// Each row is lined up in the top bits of pixel, whichever width it is
+		row := c.I + yline*rowBytes
+		pixel := uint16(c.memory[row]) << 8
+		if rowBytes == 2 {
+			pixel |= uint16(c.memory[row+1])
+		}
+		for xline := uint16(0); xline < spriteWidth; xline++ {
+			if pixel&(0x8000>>xline) != 0 {
+				px := left + xline
+				if px >= width {
+					if !c.WrapSprites {
+						break
 					}
+					px %= width
+				}
+
+				idx := px + py*width
+				c.recordPixel(idx)
+				if c.DrawMode == DrawOR {
+					// Pixels are only ever turned on, so there's nothing to collide with
+					screen[idx] = 1
+					continue
+				}
 
-					c.gfx[idx] ^= 1
+				if screen[idx] == 1 {
+					c.V[0xF] = 1
 				}
+
+				screen[idx] ^= 1
 			}
 		}
-		c.drawFlag = true
+	}
+	c.waitingForFrame = c.Quirks.DisplayWait
+	c.pc += 2
+	return nil
+}
+
+// EX9E: Skips the next instruction if the key stored in VX is pressed. (Usually the next instruction is a jump to skip a code block)
+func opEX9E(c *Chip8, opcode uint16) error {
+	if c.keys[(opcode&0x0F00)>>8] {
 		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-	case 0xE000:
-		switch opcode & 0x00FF {
-		// EX9E: Skips the next instruction if the key stored in VX is pressed. (Usually the next instruction is a jump to skip a code block)
-		case 0x009E:
-			if c.keys[(opcode&0x0F00)>>8] {
-				c.pc += 2
-			}
-			c.pc += 2
+// EXA1: Skips the next instruction if the key stored in VX isn't pressed. (Usually the next instruction is a jump to skip a code block)
+func opEXA1(c *Chip8, opcode uint16) error {
+	if !c.keys[(opcode&0x0F00)>>8] {
+		c.pc += 2
+	}
+	c.pc += 2
+	return nil
+}
 
-		// EXA1: Skips the next instruction if the key stored in VX isn't pressed. (Usually the next instruction is a jump to skip a code block)
-		case 0x00A1:
-			if !c.keys[(opcode&0x0F00)>>8] {
-				c.pc += 2
-			}
-			c.pc += 2
+// FX07: Sets VX to the value of the delay timer.
+func opFX07(c *Chip8, opcode uint16) error {
+	if c.Quirks.DelayTimerLatency {
+		c.V[(opcode&0x0F00)>>8] = c.lastDelayTimer
+	} else {
+		c.V[(opcode&0x0F00)>>8] = c.delayTimer
+	}
+	if c.V[(opcode&0x0F00)>>8] == 0 {
+		c.delayZeroReads++
+	} else {
+		c.delayRunning = true
+	}
+	c.pc += 2
+	return nil
+}
 
-		default:
-			panic(fmt.Sprintf("Unknown opcode: 0x%X", opcode))
-		}
+// FX0A: A key press is awaited, and then stored in VX. (Blocking Operation. All instruction halted until next key event)
+func opFX0A(c *Chip8, opcode uint16) error {
+	if newKey, ok := c.awaitKeyPress(); ok {
+		c.V[(opcode&0x0F00)>>8] = newKey
+		c.pc += 2
+	}
+	// Otherwise leave pc where it is, so this instruction runs again next cycle. This blocks
+	// the program without blocking the emulator, and the timers keep counting down.
+	return nil
+}
 
-	case 0xF000:
-		switch opcode & 0x00FF {
-		// FX07: Sets VX to the value of the delay timer.
-		case 0x0007:
-			c.V[(opcode&0x0F00)>>8] = c.delayTimer
-			c.pc += 2
-
-		// FX0A: A key press is awaited, and then stored in VX. (Blocking Operation. All instruction halted until next key event)
-		case 0x000A:
-			newKey := c.awaitKeyPress()
-			c.V[(opcode&0x0F00)>>8] = newKey
-			c.pc += 2
-
-		// FX15: Sets the delay timer to VX.
-		case 0x0015:
-			c.delayTimer = c.V[(opcode&0x0F00)>>8]
-			c.pc += 2
-
-		// FX18: Sets the sound timer to VX.
-		case 0x0018:
-			c.soundTimer = c.V[(opcode&0x0F00)>>8]
-			c.pc += 2
-
-		// FX1E: Adds VX to I.
-		case 0x001E:
-			c.I += uint16(c.V[(opcode&0x0F00)>>8])
-			c.pc += 2
-
-		// FX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
-		case 0x0029:
-			c.I = uint16(c.V[(opcode&0x0F00)>>8] * 0x5)
-			c.pc += 2
-
-		// FX33: Stores the binary-coded decimal representation of VX, with the most significant of three digits at the address in I,
-		// the middle digit at I plus 1, and the least significant digit at I plus 2. (In other words, take the decimal
-		// representation of VX, place the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.)
-		case 0x0033:
-			// Taken from http://www.multigesture.net/wp-content/uploads/mirror/goldroad/chip8.shtml
-			c.memory[c.I] = c.V[(opcode&0x0F00)>>8] / 100
-			c.memory[c.I+1] = (c.V[(opcode&0x0F00)>>8] / 10) % 10
-			c.memory[c.I+2] = (c.V[(opcode&0x0F00)>>8] % 100) % 10
-			c.pc += 2
-
-		// FX55: Stores V0 to VX (including VX) in memory starting at address I.
-		// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-		case 0x0055:
-			x := (opcode & 0x0F00) >> 8
-			for i := uint16(0); i < x; i++ {
-				c.memory[c.I+i] = c.V[i]
-			}
-			// On the original interpreter, when the operation is done, I = I + X + 1.
-			c.I += x + 1
-			c.pc += 2
-
-		// FX65: Fills V0 to VX (including VX) with values from memory starting at address I.
-		// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
-		case 0x0065:
-			x := (opcode & 0x0F00) >> 8
-			for i := uint16(0); i < x; i++ {
-				c.V[i] = c.memory[c.I+i]
-			}
-			// On the original interpreter, when the operation is done, I = I + X + 1.
-			c.I += x + 1
-			c.pc += 2
+// FX15: Sets the delay timer to VX.
+func opFX15(c *Chip8, opcode uint16) error {
+	c.delayTimer = c.V[(opcode&0x0F00)>>8]
+	c.delayRunning = c.delayRunning || c.delayTimer > 0
+	c.pc += 2
+	return nil
+}
 
-		default:
-			panic(fmt.Sprintf("Unknown opcode: 0x%X", opcode))
-		}
+// FX18: Sets the sound timer to VX.
+func opFX18(c *Chip8, opcode uint16) error {
+	c.soundTimer = c.V[(opcode&0x0F00)>>8]
+	// Too short to be heard, and as nothing can read the sound timer back that's the
+	// same as not setting it at all
+	if int(c.soundTimer) < c.MinSoundTimer {
+		c.soundTimer = 0
+	}
+	c.pc += 2
+	return nil
+}
 
-	default:
-		panic(fmt.Sprintf("Unknown opcode: 0x%X", opcode))
+// FX1E: Adds VX to I. With the FX1EOverflowFlag quirk, VF is set to 1 when I goes past 0xFFF,
+// and 0 when it doesn't.
+func opFX1E(c *Chip8, opcode uint16) error {
+	sum := c.I + uint16(c.V[(opcode&0x0F00)>>8])
+	overflow := byte(0)
+	if sum > 0x0FFF {
+		overflow = 1
+	}
+	c.I = sum
+	if c.Quirks.FX1EOverflowFlag {
+		c.V[0xF] = overflow
 	}
+	c.pc += 2
+	return nil
+}
+
+// FX29: Sets I to the location of the sprite for the character in VX. Characters 0-F (in hexadecimal) are represented by a 4x5 font.
+func opFX29(c *Chip8, opcode uint16) error {
+	c.I = uint16(c.V[(opcode&0x0F00)>>8]) * 5
+	c.pc += 2
+	return nil
+}
+
+// FX30: Sets I to the location of the 8x10 sprite for the digit in VX (SCHIP). Only 0-9
+// have glyphs.
+func opFX30(c *Chip8, opcode uint16) error {
+	c.I = largeFontAddress + uint16(c.V[(opcode&0x0F00)>>8]&0x0F)*10
+	c.pc += 2
+	return nil
+}
+
+// FX33: Stores the binary-coded decimal representation of VX, with the most significant of three digits at the address in I,
+// the middle digit at I plus 1, and the least significant digit at I plus 2. (In other words, take the decimal
+// representation of VX, place the hundreds digit in memory at location in I, the tens digit at location I+1, and the ones digit at location I+2.)
+func opFX33(c *Chip8, opcode uint16) error {
+	if int(c.I)+2 >= len(c.memory) {
+		return fmt.Errorf("BCD at 0x%03X writes past the end of memory", c.I)
+	}
+	// Read VX once up front. This matters for FF33, which only uses VF as a value and
+	// must not be confused by anything that treats VF as a flag.
+	v := c.V[(opcode&0x0F00)>>8]
+	// Taken from http://www.multigesture.net/wp-content/uploads/mirror/goldroad/chip8.shtml
+	c.writeMemory(c.I, v/100)
+	c.writeMemory(c.I+1, (v/10)%10)
+	c.writeMemory(c.I+2, v%10)
+	c.pc += 2
+	return nil
+}
+
+// FX55: Stores V0 to VX (including VX) in memory starting at address I.
+// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
+func opFX55(c *Chip8, opcode uint16) error {
+	// The range is inclusive, so even X=0 stores exactly one register.
+	x := (opcode & 0x0F00) >> 8
+	if int(c.I)+int(x) >= len(c.memory) {
+		return fmt.Errorf("store of V0 to V%X at 0x%03X writes past the end of memory", x, c.I)
+	}
+	for i := uint16(0); i <= x; i++ {
+		c.writeMemory(c.I+i, c.V[i])
+	}
+	// On the original interpreter, when the operation is done, I = I + X + 1.
+	if c.Quirks.LoadStoreIncrementsI {
+		c.I += x + 1
+	}
+	c.pc += 2
+	return nil
+}
+
+// FX65: Fills V0 to VX (including VX) with values from memory starting at address I.
+// The offset from I is increased by 1 for each value written, but I itself is left unmodified.
+func opFX65(c *Chip8, opcode uint16) error {
+	// The range is inclusive, so even X=0 loads exactly one register.
+	x := (opcode & 0x0F00) >> 8
+	if int(c.I)+int(x) >= len(c.memory) {
+		return fmt.Errorf("load of V0 to V%X at 0x%03X reads past the end of memory", x, c.I)
+	}
+	for i := uint16(0); i <= x; i++ {
+		c.V[i] = c.memory[c.I+i]
+	}
+	// On the original interpreter, when the operation is done, I = I + X + 1.
+	if c.Quirks.LoadStoreIncrementsI {
+		c.I += x + 1
+	}
+	c.pc += 2
+	return nil
+}
+
+// FX75: Stores V0 to VX (including VX) in the RPL user flags (SCHIP)
+func opFX75(c *Chip8, opcode uint16) error {
+	c.recordRPL()
+	flags := c.rplStore[c.romHash]
+	copy(flags[:], c.V[:((opcode&0x0F00)>>8)+1])
+	if c.rplStore == nil {
+		c.rplStore = make(map[string][16]byte)
+	}
+	c.rplStore[c.romHash] = flags
+	c.pc += 2
+	return nil
+}
+
+// FX85: Fills V0 to VX (including VX) from the RPL user flags (SCHIP)
+func opFX85(c *Chip8, opcode uint16) error {
+	flags := c.rplStore[c.romHash]
+	copy(c.V[:((opcode&0x0F00)>>8)+1], flags[:])
+	c.pc += 2
+	return nil
 }
 
 func (c *Chip8) getKeyState() [16]bool {
-	keys := [16]bool{
-		c.keyWatcher.Down(keyboard.One),
-		c.keyWatcher.Down(keyboard.Two),
-		c.keyWatcher.Down(keyboard.Three),
-		c.keyWatcher.Down(keyboard.Four),
-		c.keyWatcher.Down(keyboard.Q),
-		c.keyWatcher.Down(keyboard.W),
-		c.keyWatcher.Down(keyboard.E),
-		c.keyWatcher.Down(keyboard.R),
-		c.keyWatcher.Down(keyboard.A),
-		c.keyWatcher.Down(keyboard.S),
-		c.keyWatcher.Down(keyboard.D),
-		c.keyWatcher.Down(keyboard.F),
-		c.keyWatcher.Down(keyboard.Z),
-		c.keyWatcher.Down(keyboard.X),
-		c.keyWatcher.Down(keyboard.C),
-		c.keyWatcher.Down(keyboard.V),
-	}
-
-	if c.keyWatcher.Down(keyboard.Escape) {
-		os.Exit(1)
+	var keys [16]bool
+	if c.Keypad == nil {
+		return keys
 	}
 
+	for i := range keys {
+		keys[i] = c.Keypad.Down(uint8(i))
+	}
 	return keys
 }
 
-func (c *Chip8) awaitKeyPress() (keyIdx uint8) {
-	for {
-		// Get the current key state every 1/60th of a second
-		newKeys := c.getKeyState()
-		for i := uint8(0); i < 16; i++ {
-			if newKeys[i] && newKeys[i] != c.keys[i] {
-				// Newly pressed key, return it. Set the key state first
-				c.keys = newKeys
-				return i
-			}
+// awaitKeyPress returns the first key that has been pressed since the previous cycle, if any.
+// Keys are only read while the machine is running, so pausing during FX0A never counts as a
+// press.
+func (c *Chip8) awaitKeyPress() (keyIdx uint8, ok bool) {
+	for i := uint8(0); i < 16; i++ {
+		if c.keys[i] && !c.prevKeys[i] {
+			return i, true
 		}
-		time.Sleep(time.Second / 60)
 	}
+	return 0, false
 }
 
+// drawGraphics passes the display to the renderer.
 func (c *Chip8) drawGraphics() {
-	// tm.Clear()
-
-	// for y := 0; y < 32; y++ {
-	// 	for x := 0; x < 64; x++ {
-	// 		if c.gfx[(y*64)+x] == 1 {
-	// 			tm.Printf(tm.Background(" ", tm.WHITE))
-	// 		} else {
-	// 			tm.Printf(tm.Background(" ", tm.BLACK))
-	// 		}
-	// 	}
-	// 	tm.Printf("\n")
-	// }
-	// tm.Printf("\n")
-	// tm.Flush()
-
-	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
-
-	for y := 0; y < 32; y++ {
-		for x := 0; x < 64; x++ {
-			if c.gfx[(y*64)+x] == 1 {
-				termbox.SetCell(x, y, ' ', termbox.ColorDefault, termbox.ColorWhite)
-			} else {
-				termbox.SetCell(x, y, ' ', termbox.ColorDefault, termbox.ColorBlack)
+	if c.Renderer != nil {
+		width, height := c.Width(), c.Height()
+		c.Renderer.Draw(c.gfx[:width*height], width, height)
+	}
+	c.lastRender = time.Now()
+}
+
+// Width returns the width of the display in pixels for the current resolution mode.
+func (c *Chip8) Width() int {
+	if c.hires {
+		return hiResWidth
+	}
+	return lowResWidth
+}
+
+// Height returns the height of the display in pixels for the current resolution mode.
+func (c *Chip8) Height() int {
+	if c.hires {
+		return hiResHeight
+	}
+	return lowResHeight
+}
+
+// setHiRes switches between the low and high resolution display modes. Depending on the
+// ResolutionChangeClears quirk the screen is either cleared, or scaled to the new size so
+// the picture stays where it was.
+func (c *Chip8) setHiRes(hires bool) {
+	old := c.SaveFramebuffer()
+	oldWidth, oldHeight := c.Width(), c.Height()
+
+	c.recordDisplay()
+	c.hires = hires
+	c.gfx = [len(c.gfx)]byte{}
+	c.redraw()
+	if c.Quirks.ResolutionChangeClears {
+		return
+	}
+
+	width, height := c.Width(), c.Height()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c.gfx[(y*width)+x] = old[(y*oldHeight/height)*oldWidth+(x*oldWidth/width)]
+		}
+	}
+}
+
+// SaveFramebuffer returns a copy of the display contents at the current resolution, leaving
+// the rest of the machine alone.
+func (c *Chip8) SaveFramebuffer() []byte {
+	data := make([]byte, c.Width()*c.Height())
+	copy(data, c.gfx[:])
+	return data
+}
+
+// LoadFramebuffer restores a display previously captured with SaveFramebuffer. The machine
+// must be in the same resolution mode it was saved in.
+func (c *Chip8) LoadFramebuffer(data []byte) error {
+	if size := c.Width() * c.Height(); len(data) != size {
+		return fmt.Errorf("framebuffer is %d bytes, expected %d", len(data), size)
+	}
+	copy(c.gfx[:], data)
+	c.drawFlag = true
+	return nil
+}
+
+// Stop shuts the machine down, so EmulateCycle and every other way of running it do nothing
+// from then on. It's safe to call from another goroutine, such as a UI event loop, while the
+// machine is running.
+func (c *Chip8) Stop() {
+	atomic.StoreInt32(&c.stopped, 1)
+}
+
+// Stopped reports whether Stop has been called.
+func (c *Chip8) Stopped() bool {
+	return atomic.LoadInt32(&c.stopped) != 0
+}
+
+// EmulateCycle runs a single cycle, drawing the display and reading the keyboard as needed,
+// then sleeps to keep to the clock rate.
+func (c *Chip8) EmulateCycle() error {
+	if c.Stopped() {
+		return nil
+	}
+	if c.Paused {
+		// Nothing runs while paused. The keypad isn't read either, so a key pressed now can't
+		// satisfy an FX0A wait once emulation resumes, and there's no need to check back more
+		// than once a frame.
+		if c.drawFlag && c.Renderer != nil {
+			c.drawFlag = false
+			c.drawGraphics()
+		}
+		c.updateStatus()
+		time.Sleep(time.Second / 60)
+		// Start the schedule again on resuming, rather than rushing to catch up
+		c.nextCycle = time.Time{}
+		return nil
+	}
+
+	if err := c.cycle(); err != nil {
+		return err
+	}
+
+	c.updateBeep()
+
+	// Draw, unless there's no renderer and the display is being drawn from outside, see
+	// ShouldDraw
+	if c.drawFlag && c.Renderer != nil && c.shouldRender() {
+		c.drawFlag = false
+		c.drawGraphics()
+	}
+
+	c.pollKeys()
+	c.updateStatus()
+
+	if c.playlist != nil {
+		if err := c.playlist.advance(c); err != nil {
+			return err
+		}
+	}
+
+	// Keep to a schedule, rather than sleeping a fixed time after each cycle, so the time the
+	// cycle itself took doesn't slow the clock and timers down. It also shows when rendering
+	// is making emulation fall behind, see Config.MaxFrameSkip.
+	period := time.Second / time.Duration(c.clockHz())
+	now := time.Now()
+	if c.nextCycle.IsZero() || now.Sub(c.nextCycle) > time.Second {
+		// Don't try to catch up after a long stall, just carry on from here
+		c.nextCycle = now
+	}
+	c.nextCycle = c.nextCycle.Add(period)
+	if wait := c.nextCycle.Sub(now); wait > 0 {
+		time.Sleep(wait)
+	}
+	return nil
+}
+
+// shouldRender decides whether to render the pending display changes now. With
+// Config.MaxFrameSkip rendering only happens at the end of a frame, and frames are skipped
+// while emulation is running more than a frame behind schedule, up to the maximum in a row.
+// Config.RefreshHz holds rendering back until it's been long enough since the last one.
+func (c *Chip8) shouldRender() bool {
+	if c.RefreshHz > 0 && time.Since(c.lastRender) < time.Second/time.Duration(c.RefreshHz) {
+		return false
+	}
+	if c.MaxFrameSkip == 0 {
+		return true
+	}
+	if c.cycles%c.cyclesPerFrame() != 0 {
+		return false
+	}
+
+	behind := !c.nextCycle.IsZero() && time.Since(c.nextCycle) > time.Second/60
+	if behind && c.skippedFrames < c.MaxFrameSkip {
+		c.skippedFrames++
+		return false
+	}
+	c.skippedFrames = 0
+	return true
+}
+
+// cycle executes one instruction and updates the timers, without any rendering, input or sleeping.
+func (c *Chip8) cycle() error {
+	c.displayDirty = false
+	defer c.updateSound()
+	if c.Paused || c.Stopped() {
+		return nil
+	}
+
+	c.beginUndo()
+
+	// With the DisplayWait quirk nothing else runs after a sprite is drawn until the next frame
+	if !c.waitingForFrame {
+		if err := c.execute(); err != nil {
+			c.dumpTrace(err)
+			if !c.PauseOnError {
+				return err
 			}
+			// Stop on the faulting instruction, so it can be inspected in the debugger
+			c.fault = err
+			c.Paused = true
+			return nil
+		}
+		if c.Paused {
+			// Stopped at a breakpoint, so the instruction didn't run
+			c.dropUndo()
+			return nil
 		}
 	}
-	termbox.Flush()
+
+	// The timers count down at 60Hz, whatever the clock speed, so they're updated once a frame
+	// of cycles rather than every cycle
+	c.lastDelayTimer = c.delayTimer
+	c.cycles++
+	if c.cycles%c.cyclesPerFrame() == 0 {
+		c.updateTimers()
+		c.endFrame()
+	}
+	return nil
 }
 
-func (c *Chip8) EmulateCycle() {
+// execute fetches and runs the instruction at pc.
+func (c *Chip8) execute() error {
 	// First fetch the current opcode.
-	opcode := c.fetchOpcode()
+	opcode, err := c.fetchOpcode()
+	if err != nil {
+		return err
+	}
+	c.opcode = opcode
+
+	if !c.skipBreak && c.shouldBreak(opcode) {
+		c.Paused = true
+		return nil
+	}
+	c.skipBreak = false
+	c.executed[c.pc] = true
+	c.executed[c.pc+1] = true
+	c.trace.add(c.TraceDepth, TraceEntry{PC: c.pc, Opcode: opcode})
+	if c.Tracer != nil {
+		asm, _ := Mnemonic(opcode)
+		c.Tracer(c.pc, opcode, asm)
+	}
+
+	if c.TrapVFWrites && writesVFAsData(opcode) {
+		c.warnf("0x%03X: opcode 0x%04X writes to VF, which is normally only set as a flag", c.pc, opcode)
+	}
 
 	// Next decode it
-	c.decodeOpcode(opcode)
+	if !c.watchingRegisters {
+		return c.decodeOpcode(opcode)
+	}
+	before := c.V
+	err = c.decodeOpcode(opcode)
+	c.checkRegisterWatches(before)
+	return err
+}
 
-	// Draw
-	if c.drawFlag {
-		c.drawFlag = false
-		c.drawGraphics()
+// redraw flags that the program has changed the display. The flag is a latch that's only
+// cleared when the display is actually rendered, so any number of changes in between are
+// shown together by a single render.
+func (c *Chip8) redraw() {
+	c.drawFlag = true
+	c.drewThisFrame = true
+	c.displayDirty = true
+}
+
+// DisplayDirty reports whether the instruction run by the last cycle changed the display.
+// Unlike the flag used to trigger a render, it isn't cleared by rendering, so a front end
+// that draws the display itself can use it to decide whether to repaint.
+func (c *Chip8) DisplayDirty() bool {
+	return c.displayDirty
+}
+
+// writeMemory stores b at addr on behalf of the running program.
+func (c *Chip8) writeMemory(addr uint16, b byte) {
+	if c.TrapSelfModify && c.executed[addr] && !c.selfModWarned[addr] {
+		if c.selfModWarned == nil {
+			c.selfModWarned = make(map[uint16]bool)
+		}
+		c.selfModWarned[addr] = true
+		c.warnf("0x%03X: self-modifying code, opcode 0x%04X wrote to 0x%03X which has already been executed",
+			c.pc, c.opcode, addr)
+	}
+	c.recordMemory(addr)
+	if c.memoryWatches != nil {
+		c.checkMemoryWatch(addr, b)
 	}
+	c.memory[addr] = b
+}
+
+// checkSpriteRead warns, once for each sprite address, if a sprite of size bytes at I takes
+// some of its rows from memory that has been executed as code. That's usually a sign the
+// height is wrong.
+func (c *Chip8) checkSpriteRead(size uint16) {
+	if c.spriteWarned[c.I] {
+		return
+	}
+	for offset := uint16(0); offset < size; offset++ {
+		if c.executed[c.I+offset] {
+			if c.spriteWarned == nil {
+				c.spriteWarned = make(map[uint16]bool)
+			}
+			c.spriteWarned[c.I] = true
+			c.warnf("0x%03X: sprite at 0x%03X of %d bytes reads into code at 0x%03X", c.pc, c.I, size, c.I+offset)
+			return
+		}
+	}
+}
+
+// writesVFAsData reports whether opcode stores an ordinary value into VF, rather than being one
+// of the opcodes that use it as a carry/borrow/collision flag.
+func writesVFAsData(opcode uint16) bool {
+	if (opcode&0x0F00)>>8 != 0xF {
+		return false
+	}
+
+	switch opcode & 0xF000 {
+	case 0x6000, 0x7000, 0xC000:
+		return true
+	case 0x8000:
+		// 8XY0 to 8XY3, the rest are arithmetic and set VF themselves
+		return opcode&0x000F <= 0x0003
+	case 0xF000:
+		switch opcode & 0x00FF {
+		case 0x0007, 0x000A, 0x0065:
+			return true
+		}
+	}
+	return false
+}
+
+// clockHz is the configured clock rate, falling back to the default if it's been left unset
+// or set to something that can't be run at.
+func (c *Chip8) clockHz() int {
+	if c.ClockHz > 0 {
+		return c.ClockHz
+	}
+	return defaultClockHz
+}
 
-	c.keys = c.getKeyState()
+// cyclesPerFrame is how many instructions run in each 60Hz frame at the configured clock rate.
+func (c *Chip8) cyclesPerFrame() int {
+	if n := c.clockHz() / 60; n > 0 {
+		return n
+	}
+	return 1
+}
 
-	// And update timers
+// updateTimers counts the delay and sound timers down by one.
+func (c *Chip8) updateTimers() {
 	if c.delayTimer > 0 {
 		c.delayTimer--
 	}
-
 	if c.soundTimer > 0 {
-		if c.soundTimer == 1 {
-			fmt.Printf("BEEP!!\n")
-		}
 		c.soundTimer--
 	}
+}
 
-	time.Sleep(time.Second / 540)
+func (c *Chip8) endFrame() {
+	if c.drewThisFrame {
+		c.framesWithoutDraw = 0
+	} else {
+		c.framesWithoutDraw++
+		// Only warn the once, when the threshold is crossed
+		if c.NoDrawWarnFrames > 0 && c.framesWithoutDraw == c.NoDrawWarnFrames {
+			c.warnf("nothing has been drawn for %d frames; this ROM may only compute into registers and memory, "+
+				"which won't show up on screen. Try inspecting the registers instead", c.framesWithoutDraw)
+		}
+	}
+	c.drewThisFrame = false
+	c.waitingForFrame = false
+
+	// Reading a zero delay timer over and over, without it ever running, is a loop waiting for
+	// a timer that was never started
+	if c.delayZeroReads > 1 && !c.delayRunning {
+		c.delaySpinFrames++
+		if c.DelayWaitWarnFrames > 0 && c.delaySpinFrames == c.DelayWaitWarnFrames {
+			c.warnf("0x%03X: the delay timer has been read as zero over and over for %d frames without being set; "+
+				"this may be a wait on a timer that was never started", c.pc, c.delaySpinFrames)
+		}
+	} else {
+		c.delaySpinFrames = 0
+	}
+	c.delayZeroReads = 0
+	c.delayRunning = c.delayTimer > 0
+
+	c.checkDemoFrame()
+}
+
+// random returns a random byte for CXNN.
+func (c *Chip8) random() (byte, error) {
+	if c.RandomSource != nil {
+		var b [1]byte
+		if _, err := io.ReadFull(c.RandomSource, b[:]); err != nil {
+			return 0, fmt.Errorf("reading the random source: %v", err)
+		}
+		return b[0], nil
+	}
+	if c.Rand != nil {
+		return byte(c.Rand.Intn(256)), nil
+	}
+	return byte(rand.Intn(256)), nil
+}
+
+func (c *Chip8) warnf(format string, args ...interface{}) {
+	if c.Log != nil {
+		c.Log.Printf(format, args...)
+	}
 }
@@ -0,0 +1,916 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"log"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// newTestChip8 returns a machine with rom loaded at 0x200, with no keypad and nothing drawn to
+// the terminal.
+func newTestChip8(t testing.TB, rom ...byte) *Chip8 {
+	t.Helper()
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Keypad = nil
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// step runs n instructions, failing the test if any of them fail.
+func step(t testing.TB, c *Chip8, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, err := c.Step(); err != nil {
+			t.Fatalf("instruction %d: %v", i+1, err)
+		}
+	}
+}
+
+// runFrames runs n frames' worth of cycles, failing the test if any of them fail.
+func runFrames(t *testing.T, c *Chip8, n int) {
+	t.Helper()
+	for i := 0; i < n*c.cyclesPerFrame(); i++ {
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test8XY5(t *testing.T) {
+	tests := []struct {
+		vx, vy     byte
+		want, flag byte
+	}{
+		{vx: 5, vy: 3, want: 2, flag: 1},
+		{vx: 3, vy: 5, want: 0xFE, flag: 0},
+		{vx: 7, vy: 7, want: 0, flag: 1},
+		{vx: 0, vy: 1, want: 0xFF, flag: 0},
+		{vx: 0xFF, vy: 0, want: 0xFF, flag: 1},
+		{vx: 0, vy: 0xFF, want: 1, flag: 0},
+		{vx: 0x80, vy: 0x7F, want: 1, flag: 1},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, 0x81, 0x25)
+		c.V[1], c.V[2] = tt.vx, tt.vy
+		step(t, c, 1)
+		if c.V[1] != tt.want || c.V[0xF] != tt.flag {
+			t.Errorf("0x%02X - 0x%02X = 0x%02X with VF %d, want 0x%02X with VF %d", tt.vx, tt.vy, c.V[1], c.V[0xF], tt.want, tt.flag)
+		}
+	}
+}
+
+func TestFlagWinsInVF(t *testing.T) {
+	tests := []struct {
+		opcode uint16
+		vf, vy byte
+		flag   byte
+	}{
+		{0x8F14, 0xFF, 0x01, 1}, // 0x00, with a carry
+		{0x8F14, 0x01, 0x01, 0}, // 0x02
+		{0x8F15, 0x01, 0x02, 0}, // 0xFF, with a borrow
+		{0x8F15, 0x03, 0x01, 1}, // 0x02
+		{0x8F17, 0x02, 0x01, 0}, // 0xFF, with a borrow
+		{0x8F17, 0x01, 0x03, 1}, // 0x02
+		{0x8F16, 0x03, 0x00, 1}, // 0x01
+		{0x8F16, 0x02, 0x00, 0}, // 0x01
+		{0x8F1E, 0x81, 0x00, 1}, // 0x02
+		{0x8F1E, 0x01, 0x00, 0}, // 0x02
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, byte(tt.opcode>>8), byte(tt.opcode))
+		c.V[0xF], c.V[1] = tt.vf, tt.vy
+		step(t, c, 1)
+		if c.V[0xF] != tt.flag {
+			t.Errorf("0x%04X with VF=0x%02X VY=0x%02X: VF = 0x%02X, want the flag %d", tt.opcode, tt.vf, tt.vy, c.V[0xF], tt.flag)
+		}
+	}
+}
+
+// cyclesIn counts the instructions EmulateCycle gets through in d at hz, with the rest of the
+// configuration at its defaults. Zero leaves the default clock rate.
+func cyclesIn(t *testing.T, hz int, d time.Duration) int {
+	t.Helper()
+	c := newTestChip8(t, 0x12, 0x00)
+	if hz != 0 {
+		c.ClockHz = hz
+	}
+	for start := time.Now(); time.Since(start) < d; {
+		if err := c.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c.cycles
+}
+
+func TestClockHzSetsSpeed(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs in real time")
+	}
+	const d = 500 * time.Millisecond
+	for _, hz := range []int{0, 200, 800} {
+		rate := hz
+		if rate == 0 {
+			rate = defaultClockHz
+		}
+		// Within 5% of half a second's worth
+		want := rate / 2
+		if got := cyclesIn(t, hz, d); got < want*95/100 || got > want*105/100 {
+			t.Errorf("ran %d cycles in %v at %dHz, want about %d", got, d, rate, want)
+		}
+	}
+}
+
+func TestClockHzUnset(t *testing.T) {
+	c := newTestChip8(t, 0x12, 0x00)
+	c.ClockHz = 0
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.cyclesPerFrame(); got != defaultClockHz/60 {
+		t.Errorf("cyclesPerFrame() = %d with no clock rate, want the default %d", got, defaultClockHz/60)
+	}
+}
+
+func TestTimersTickAt60Hz(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs in real time")
+	}
+	// Zero leaves the default clock rate, with the rest of the configuration at its defaults too
+	for _, hz := range []int{0, 300, 1200} {
+		// LD V0, 0xFF; LD DT, V0; JP 0x204
+		c := newTestChip8(t, 0x60, 0xFF, 0xF0, 0x15, 0x12, 0x04)
+		if hz != 0 {
+			c.ClockHz = hz
+		}
+		step(t, c, 2)
+		for start := time.Now(); time.Since(start) < 500*time.Millisecond; {
+			if err := c.EmulateCycle(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// 30 ticks in half a second, whatever the clock rate
+		if ticks := 0xFF - int(c.delayTimer); ticks < 27 || ticks > 33 {
+			t.Errorf("delay timer ticked %d times in 500ms at %dHz, want about 30", ticks, c.clockHz())
+		}
+	}
+}
+
+// callROM calls a subroutine at 0x206 that sets V0 and returns to set V1.
+var callROM = []byte{
+	0x22, 0x06, // 200: CALL 0x206
+	0x61, 0x01, // 202: LD V1, 1
+	0x12, 0x04, // 204: JP 0x204
+	0x60, 0x01, // 206: LD V0, 1
+	0x00, 0xEE, // 208: RET
+}
+
+func TestCallReturn(t *testing.T) {
+	c := newTestChip8(t, callROM...)
+
+	step(t, c, 1)
+	if c.PC() != 0x206 {
+		t.Fatalf("pc 0x%03X after the call, want 0x206", c.PC())
+	}
+	if stack := c.Stack(); len(stack) != 1 || stack[0] != 0x202 {
+		t.Fatalf("stack %03X after the call, want the return address [202]", stack)
+	}
+
+	step(t, c, 2)
+	if c.PC() != 0x202 || c.SP() != 0 {
+		t.Fatalf("pc 0x%03X with %d calls on the stack after the return, want 0x202 with none", c.PC(), c.SP())
+	}
+	step(t, c, 1)
+	if c.V[0] != 1 || c.V[1] != 1 {
+		t.Errorf("V0=%d V1=%d, want both set by the subroutine and the code after the call", c.V[0], c.V[1])
+	}
+}
+
+func TestReturnWithEmptyStack(t *testing.T) {
+	c := newTestChip8(t, 0x00, 0xEE)
+	_, err := c.Step()
+	if err == nil || !strings.Contains(err.Error(), "stack underflow") {
+		t.Errorf("got error %v, want a stack underflow", err)
+	}
+	if c.pc != 0x200 || c.sp != 0 {
+		t.Errorf("pc 0x%03X with sp %d, want the machine left at the return with sp 0", c.pc, c.sp)
+	}
+}
+
+func TestCallStackOverflow(t *testing.T) {
+	// CALL 0x200, over and over
+	c := newTestChip8(t, 0x22, 0x00)
+	step(t, c, 16)
+	if c.sp != 16 {
+		t.Fatalf("%d calls on the stack, want all 16 slots full", c.sp)
+	}
+	_, err := c.Step()
+	if err == nil || !strings.Contains(err.Error(), "stack overflow") {
+		t.Errorf("17th call: got error %v, want a stack overflow", err)
+	}
+	if c.sp != 16 {
+		t.Errorf("sp %d after the overflow, want it left at 16", c.sp)
+	}
+}
+
+func TestDrawFontDigit(t *testing.T) {
+	// LD I, 0x00A; LD V0, 0; DRW V0, V0, 5: digit 2 straight out of the font region
+	c := newTestChip8(t, 0xA0, 0x0A, 0x60, 0x00, 0xD0, 0x05)
+	step(t, c, 3)
+
+	glyph := Chip8Fontset[10:15]
+	for y, row := range glyph {
+		for x := 0; x < 8; x++ {
+			want := row>>(7-x)&1 == 1
+			if got := c.gfx[y*c.Width()+x] != 0; got != want {
+				t.Errorf("pixel (%d, %d) is %v, want %v for row 0x%02X of the glyph", x, y, got, want, row)
+			}
+		}
+	}
+	if c.V[0xF] != 0 {
+		t.Errorf("VF = %d drawing on a blank screen, want 0", c.V[0xF])
+	}
+}
+
+func TestFX1EOverflowFlag(t *testing.T) {
+	tests := []struct {
+		v        byte
+		quirk    bool
+		i        uint16
+		vf, want byte
+	}{
+		{0x0F, false, 0xFFF, 0xAA, 0xAA},
+		{0x10, false, 0x1000, 0xAA, 0xAA},
+		{0x0F, true, 0xFFF, 0xAA, 0},
+		{0x10, true, 0x1000, 0xAA, 1},
+	}
+	for _, tt := range tests {
+		// LD I, 0xFF0; ADD I, V0
+		c := newTestChip8(t, 0xAF, 0xF0, 0xF0, 0x1E)
+		c.Quirks.FX1EOverflowFlag = tt.quirk
+		c.V[0], c.V[0xF] = tt.v, tt.vf
+		step(t, c, 2)
+		if c.I != tt.i || c.V[0xF] != tt.want {
+			t.Errorf("0xFF0 + 0x%02X with the quirk %v: I=0x%03X VF=0x%02X, want I=0x%03X VF=0x%02X",
+				tt.v, tt.quirk, c.I, c.V[0xF], tt.i, tt.want)
+		}
+	}
+}
+
+func TestFontAddress(t *testing.T) {
+	for digit := byte(0); digit <= 0xF; digit++ {
+		// LD V4, digit; LD F, V4
+		c := newTestChip8(t, 0x64, digit, 0xF4, 0x29)
+		step(t, c, 2)
+		if want := uint16(digit) * 5; c.I != want {
+			t.Errorf("digit %X: I = %d, want %d", digit, c.I, want)
+		}
+	}
+}
+
+func TestSaveFramebufferIsACopy(t *testing.T) {
+	// (I is at digit 0) DRW V0, V0, 5; HIGH
+	c := newTestChip8(t, 0xD0, 0x05, 0x00, 0xFF)
+	step(t, c, 1)
+	fb := c.SaveFramebuffer()
+	if len(fb) != 64*32 || fb[0] == 0 {
+		t.Fatalf("framebuffer is %d bytes with the first pixel %d, want 2048 with it set", len(fb), fb[0])
+	}
+	for i := range fb {
+		fb[i] ^= 1
+	}
+	if c.gfx[0] == 0 || c.gfx[1000] != 0 {
+		t.Error("changing the framebuffer changed the display")
+	}
+
+	step(t, c, 1)
+	if fb := c.SaveFramebuffer(); len(fb) != 128*64 || c.Width() != 128 || c.Height() != 64 {
+		t.Errorf("framebuffer is %d bytes at %dx%d in hi-res, want 8192 at 128x64", len(fb), c.Width(), c.Height())
+	}
+}
+
+func TestSaveLoadFramebuffer(t *testing.T) {
+	// LD V0, 8; LD F, V0; DRW V0, V0, 5; CLS
+	c := newTestChip8(t, 0x60, 0x08, 0xF0, 0x29, 0xD0, 0x05, 0x00, 0xE0)
+	step(t, c, 3)
+	drawn := c.gfx
+	saved := c.SaveFramebuffer()
+
+	step(t, c, 1)
+	if c.gfx == drawn {
+		t.Fatal("00E0 didn't clear the display")
+	}
+	pc, i, v := c.pc, c.I, c.V
+	if err := c.LoadFramebuffer(saved); err != nil {
+		t.Fatal(err)
+	}
+	if c.gfx != drawn {
+		t.Error("the display isn't the one saved")
+	}
+	if c.pc != pc || c.I != i || c.V != v {
+		t.Error("loading the framebuffer changed the CPU state")
+	}
+
+	c.setHiRes(true)
+	if err := c.LoadFramebuffer(saved); err == nil {
+		t.Error("loaded a low-res framebuffer in hi-res")
+	}
+}
+
+func TestNoDrawWarning(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rom  []byte
+		warn bool
+	}{
+		// ADD V0, 1; JP 0x200
+		{"compute", []byte{0x70, 0x01, 0x12, 0x00}, true},
+		// DRW V0, V0, 1; JP 0x200
+		{"draw", []byte{0xD0, 0x01, 0x12, 0x00}, false},
+	} {
+		c := newTestChip8(t, tt.rom...)
+		var logged bytes.Buffer
+		c.Log = log.New(&logged, "", 0)
+		c.NoDrawWarnFrames = 3
+
+		runFrames(t, c, 2)
+		if logged.Len() != 0 {
+			t.Errorf("%s: warned after 2 frames: %q", tt.name, logged.String())
+		}
+		runFrames(t, c, 5)
+		if n := strings.Count(logged.String(), "nothing has been drawn"); tt.warn && n != 1 {
+			t.Errorf("%s: warned %d times after 7 frames without drawing, want once", tt.name, n)
+		} else if !tt.warn && n != 0 {
+			t.Errorf("%s: warned about a ROM that draws: %q", tt.name, logged.String())
+		}
+	}
+}
+
+func TestResolutionChange(t *testing.T) {
+	// DRW V0, V0, 1 (I is at the top row of digit 0, 0xF0); HIGH; DRW V0, V0, 1; LOW
+	rom := []byte{0xD0, 0x01, 0x00, 0xFF, 0xD0, 0x01, 0x00, 0xFE}
+	for _, clears := range []bool{true, false} {
+		c := newTestChip8(t, rom...)
+		c.Quirks.ResolutionChangeClears = clears
+
+		step(t, c, 1)
+		c.drawFlag = false
+		step(t, c, 1)
+		if !c.hires || c.Width() != 128 || c.Height() != 64 {
+			t.Fatalf("clears %v: %dx%d after 00FF, want 128x64", clears, c.Width(), c.Height())
+		}
+		if !c.drawFlag {
+			t.Errorf("clears %v: the draw flag isn't set after 00FF", clears)
+		}
+		// Without the quirk the 4 pixel line is scaled up to 8 by 2
+		want := 0
+		if !clears {
+			want = 16
+		}
+		if n := len(setPixels(c)); n != want {
+			t.Errorf("clears %v: %d pixels set after 00FF, want %d", clears, n, want)
+		}
+
+		step(t, c, 1)
+		c.drawFlag = false
+		step(t, c, 1)
+		if c.hires || !c.drawFlag {
+			t.Errorf("clears %v: hires %v with draw flag %v after 00FE, want low-res and the flag set", clears, c.hires, c.drawFlag)
+		}
+		if clears {
+			if n := len(setPixels(c)); n != 0 {
+				t.Errorf("clears %v: %d pixels set after 00FE, want none", clears, n)
+			}
+		}
+	}
+}
+
+func TestTrapVFWrites(t *testing.T) {
+	// LD VF, 1; ADD VF, V0 (8F04 sets VF as a carry, so isn't reported)
+	c := newTestChip8(t, 0x6F, 0x01, 0x8F, 0x04)
+	var logged bytes.Buffer
+	c.Log = log.New(&logged, "", 0)
+	c.TrapVFWrites = true
+
+	step(t, c, 1)
+	if !strings.Contains(logged.String(), "0x6F01 writes to VF") {
+		t.Errorf("logged %q for 6F01, want it reported", logged.String())
+	}
+	logged.Reset()
+	step(t, c, 1)
+	if logged.Len() != 0 {
+		t.Errorf("logged %q for 8F04, which sets VF as a flag", logged.String())
+	}
+}
+
+func TestLoadAllRegisters(t *testing.T) {
+	// LD I, 0x300; LD VF, [I]
+	c := newTestChip8(t, 0xA3, 0x00, 0xFF, 0x65)
+	for i := 0; i < 16; i++ {
+		c.memory[0x300+i] = byte(0x10 + i)
+	}
+	step(t, c, 2)
+	for i, v := range c.V {
+		if v != byte(0x10+i) {
+			t.Errorf("V%X = 0x%02X, want 0x%02X", i, v, 0x10+i)
+		}
+	}
+}
+
+func TestLoadStoreV0Only(t *testing.T) {
+	for _, increments := range []bool{false, true} {
+		// LD V1, 0x11; LD I, 0x300; LD V0, [I]
+		c := newTestChip8(t, 0x61, 0x11, 0xA3, 0x00, 0xF0, 0x65)
+		c.Quirks.LoadStoreIncrementsI = increments
+		c.memory[0x300], c.memory[0x301] = 0xAA, 0xBB
+		step(t, c, 3)
+
+		if c.V[0] != 0xAA || c.V[1] != 0x11 {
+			t.Errorf("increments %v: V0=0x%02X V1=0x%02X, want only V0 loaded, with 0xAA", increments, c.V[0], c.V[1])
+		}
+		want := uint16(0x300)
+		if increments {
+			want = 0x301
+		}
+		if c.I != want {
+			t.Errorf("increments %v: I = 0x%03X, want 0x%03X", increments, c.I, want)
+		}
+	}
+
+	// LD V0, 0xCC; LD I, 0x300; LD [I], V0
+	c := newTestChip8(t, 0x60, 0xCC, 0xA3, 0x00, 0xF0, 0x55)
+	step(t, c, 3)
+	if c.memory[0x300] != 0xCC || c.memory[0x301] != 0 {
+		t.Errorf("stored 0x%02X 0x%02X, want only V0 stored", c.memory[0x300], c.memory[0x301])
+	}
+}
+
+func TestDrawModes(t *testing.T) {
+	// (I is at the top row of digit 0, 0xF0) DRW V0, V0, 1; LD V1, 2; DRW V1, V0, 1
+	rom := []byte{0xD0, 0x01, 0x61, 0x02, 0xD1, 0x01}
+	tests := []struct {
+		mode DrawMode
+		want []image.Point
+		flag byte
+	}{
+		{DrawXOR, []image.Point{{0, 0}, {1, 0}, {4, 0}, {5, 0}}, 1},
+		{DrawOR, []image.Point{{0, 0}, {1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}}, 0},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, rom...)
+		c.DrawMode = tt.mode
+		step(t, c, 3)
+		if got := setPixels(c); !reflect.DeepEqual(got, tt.want) || c.V[0xF] != tt.flag {
+			t.Errorf("mode %v: pixels %v with VF %d, want %v with VF %d", tt.mode, got, c.V[0xF], tt.want, tt.flag)
+		}
+	}
+}
+
+func TestTrapSelfModify(t *testing.T) {
+	// LD V0, 0x12; LD I, 0x300; LD [I], V0; LD I, 0x200; LD [I], V0
+	c := newTestChip8(t, 0x60, 0x12, 0xA3, 0x00, 0xF0, 0x55, 0xA2, 0x00, 0xF0, 0x55)
+	var logged bytes.Buffer
+	c.Log = log.New(&logged, "", 0)
+	c.TrapSelfModify = true
+
+	step(t, c, 3)
+	if logged.Len() != 0 {
+		t.Errorf("logged %q for a write to data, want nothing", logged.String())
+	}
+	step(t, c, 2)
+	if !strings.Contains(logged.String(), "wrote to 0x200") {
+		t.Errorf("logged %q for a write over the first instruction, want it reported", logged.String())
+	}
+}
+
+func TestDelayTimerLatency(t *testing.T) {
+	// LD V0, 3; LD DT, V0; then LD V1, DT over and over as the timer counts down
+	rom := []byte{0x60, 0x03, 0xF0, 0x15}
+	for i := 0; i < 40; i++ {
+		rom = append(rom, 0xF1, 0x07)
+	}
+	reads := func(latency bool) []byte {
+		c := newTestChip8(t, rom...)
+		c.Quirks.DelayTimerLatency = latency
+		step(t, c, 2)
+		var values []byte
+		for i := 0; i < 40; i++ {
+			step(t, c, 1)
+			values = append(values, c.V[1])
+		}
+		return values
+	}
+	direct, latent := reads(false), reads(true)
+
+	if direct[0] != 3 || direct[len(direct)-1] != 0 {
+		t.Fatalf("read %v without latency, want the timer counting down from 3 to 0", direct)
+	}
+	// Each tick shows up one read later with the latency
+	if latent[0] != direct[0] || !bytes.Equal(latent[1:], direct[:len(direct)-1]) {
+		t.Errorf("read %v with latency, want %v a read behind", latent, direct)
+	}
+}
+
+func TestShifts(t *testing.T) {
+	tests := []struct {
+		opcode      uint16
+		shiftUsesVY bool
+		vx, vf      byte
+	}{
+		{0x8016, false, 0x40, 1},
+		{0x8016, true, 0x21, 0},
+		{0x801E, false, 0x02, 1},
+		{0x801E, true, 0x84, 0},
+	}
+	for _, tt := range tests {
+		// LD V0, 0x81; LD V1, 0x42; then the shift
+		c := newTestChip8(t, 0x60, 0x81, 0x61, 0x42, byte(tt.opcode>>8), byte(tt.opcode))
+		c.Quirks.ShiftUsesVY = tt.shiftUsesVY
+		step(t, c, 3)
+		if c.V[0] != tt.vx || c.V[1] != 0x42 || c.V[0xF] != tt.vf {
+			t.Errorf("0x%04X with shift uses VY %v: VX=0x%02X VY=0x%02X VF=%d, want VX=0x%02X VY=0x42 VF=%d",
+				tt.opcode, tt.shiftUsesVY, c.V[0], c.V[1], c.V[0xF], tt.vx, tt.vf)
+		}
+	}
+}
+
+func Test8XY6(t *testing.T) {
+	tests := []struct {
+		vx, want, flag byte
+	}{
+		{vx: 0x01, want: 0x00, flag: 1},
+		{vx: 0x02, want: 0x01, flag: 0},
+		{vx: 0x0F, want: 0x07, flag: 1},
+		{vx: 0xFE, want: 0x7F, flag: 0},
+		{vx: 0xFF, want: 0x7F, flag: 1},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, 0x81, 0x26)
+		c.V[1] = tt.vx
+		step(t, c, 1)
+		if c.V[1] != tt.want || c.V[0xF] != tt.flag {
+			t.Errorf("0x%02X >> 1 = 0x%02X with VF %d, want 0x%02X with VF %d", tt.vx, c.V[1], c.V[0xF], tt.want, tt.flag)
+		}
+	}
+}
+
+func TestQuirks(t *testing.T) {
+	tests := []struct {
+		name    string
+		rom     []byte
+		set     func(q *Quirks)
+		got     func(c *Chip8) int
+		off, on int
+	}{
+		{
+			name: "ShiftUsesVY",
+			// LD V0, 0x81; LD V1, 0x42; SHR V0, V1
+			rom: []byte{0x60, 0x81, 0x61, 0x42, 0x80, 0x16},
+			set: func(q *Quirks) { q.ShiftUsesVY = true },
+			got: func(c *Chip8) int { return int(c.V[0]) },
+			off: 0x40, on: 0x21,
+		},
+		{
+			name: "LoadStoreIncrementsI",
+			// LD I, 0x300; LD [I], V1
+			rom: []byte{0xA3, 0x00, 0xF1, 0x55},
+			set: func(q *Quirks) { q.LoadStoreIncrementsI = true },
+			got: func(c *Chip8) int { return int(c.I) },
+			off: 0x300, on: 0x302,
+		},
+		{
+			name: "JumpUsesVX",
+			// LD V0, 2; LD V2, 6; JP V0, 0x210
+			rom: []byte{0x60, 0x02, 0x62, 0x06, 0xB2, 0x10},
+			set: func(q *Quirks) { q.JumpUsesVX = true },
+			got: func(c *Chip8) int { return int(c.pc) },
+			off: 0x212, on: 0x216,
+		},
+	}
+	for _, tt := range tests {
+		for _, on := range []bool{false, true} {
+			c := newTestChip8(t, tt.rom...)
+			c.Quirks = Quirks{}
+			want := tt.off
+			if on {
+				tt.set(&c.Quirks)
+				want = tt.on
+			}
+			step(t, c, len(tt.rom)/2)
+			if got := tt.got(c); got != want {
+				t.Errorf("%s %v: got 0x%X, want 0x%X", tt.name, on, got, want)
+			}
+		}
+	}
+}
+
+func TestNestedCallReturns(t *testing.T) {
+	c := newTestChip8(t,
+		0x22, 0x06, // 200: CALL 0x206
+		0x62, 0x01, // 202: LD V2, 1
+		0x12, 0x04, // 204: JP 0x204
+		0x22, 0x0C, // 206: CALL 0x20C
+		0x61, 0x01, // 208: LD V1, 1
+		0x00, 0xEE, // 20A: RET
+		0x60, 0x01, // 20C: LD V0, 1
+		0x00, 0xEE, // 20E: RET
+	)
+	for _, want := range []struct {
+		steps int
+		pc    uint16
+		sp    uint16
+	}{
+		{2, 0x20C, 2},
+		{2, 0x208, 1}, // the inner RET
+		{2, 0x202, 0}, // the outer RET
+	} {
+		step(t, c, want.steps)
+		if c.pc != want.pc || c.sp != want.sp {
+			t.Fatalf("pc 0x%03X with %d calls on the stack, want 0x%03X with %d", c.pc, c.sp, want.pc, want.sp)
+		}
+	}
+	step(t, c, 1)
+	if c.V[0] != 1 || c.V[1] != 1 || c.V[2] != 1 {
+		t.Errorf("V0=%d V1=%d V2=%d, want every level to have run", c.V[0], c.V[1], c.V[2])
+	}
+}
+
+func TestSpriteAtEdge(t *testing.T) {
+	// A 4x4 sprite in the bottom right corner, in the order setPixels lists them
+	clipped := []image.Point{{62, 30}, {63, 30}, {62, 31}, {63, 31}}
+	wrapped := []image.Point{
+		{0, 0}, {1, 0}, {62, 0}, {63, 0},
+		{0, 1}, {1, 1}, {62, 1}, {63, 1},
+		{0, 30}, {1, 30}, {62, 30}, {63, 30},
+		{0, 31}, {1, 31}, {62, 31}, {63, 31},
+	}
+
+	tests := []struct {
+		wrap bool
+		want []image.Point
+	}{
+		{false, clipped},
+		{true, wrapped},
+	}
+	for _, tt := range tests {
+		// LD V0, 62; LD V1, 30; LD I, 0x300; DRW V0, V1, 4; DRW V0, V1, 4
+		c := newTestChip8(t, 0x60, 62, 0x61, 30, 0xA3, 0x00, 0xD0, 0x14, 0xD0, 0x14)
+		c.WrapSprites = tt.wrap
+		copy(c.memory[0x300:], []byte{0xF0, 0xF0, 0xF0, 0xF0})
+		step(t, c, 4)
+		if got := setPixels(c); !reflect.DeepEqual(got, tt.want) || c.V[0xF] != 0 {
+			t.Errorf("wrap %v: set %v with VF %d, want %v with VF 0", tt.wrap, got, c.V[0xF], tt.want)
+		}
+
+		// Drawing it again rubs it all out, colliding
+		step(t, c, 1)
+		if got := setPixels(c); len(got) != 0 || c.V[0xF] != 1 {
+			t.Errorf("wrap %v: %v still set with VF %d after redrawing, want none with VF 1", tt.wrap, got, c.V[0xF])
+		}
+	}
+}
+
+func TestPCOffTheEnd(t *testing.T) {
+	c := newTestChip8(t)
+	// LD V0, 1 in the last two bytes of memory
+	c.memory[0xFFE], c.memory[0xFFF] = 0x60, 0x01
+	c.pc = 0xFFE
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatalf("the last instruction in memory failed: %v", err)
+	}
+	if c.V[0] != 1 {
+		t.Errorf("V0 = %d, want the instruction at 0xFFE run", c.V[0])
+	}
+
+	for _, pc := range []uint16{0x1000, 0xFFF} {
+		c.pc = pc
+		var pcErr PCOutOfRangeError
+		if err := c.EmulateCycle(); !errors.As(err, &pcErr) || uint16(pcErr) != pc {
+			t.Errorf("pc 0x%03X: got error %v, want a PCOutOfRangeError for 0x%03X", pc, err, pc)
+		}
+	}
+}
+
+func TestSpriteOverread(t *testing.T) {
+	c := newTestChip8(t,
+		0x12, 0x06, // 200: JP 0x206
+		0xFF, 0x81, // 202: two rows of sprite data
+		0x3C, 0x00, // 204: and whatever follows it
+		0xA2, 0x02, // 206: LD I, 0x202
+		0xD0, 0x05, // 208: DRW V0, V0, 5
+		0x12, 0x0A, // 20A: JP 0x20A
+	)
+	var logged bytes.Buffer
+	c.Log = log.New(&logged, "", 0)
+	c.TrapSpriteOverread = true
+	step(t, c, 3)
+
+	// The rows past the data come from the bytes that follow it, here the LD I at 0x206
+	for y, row := range []byte{0xFF, 0x81, 0x3C, 0x00, 0xA2} {
+		for x := 0; x < 8; x++ {
+			want := row>>(7-x)&1 == 1
+			if got := c.gfx[y*c.Width()+x] != 0; got != want {
+				t.Errorf("pixel (%d, %d) is %v, want %v for row 0x%02X", x, y, got, want, row)
+			}
+		}
+	}
+	if !strings.Contains(logged.String(), "reads into code at 0x206") {
+		t.Errorf("logged %q, want the read into code reported", logged.String())
+	}
+}
+
+func TestDelayWaitWarning(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rom  []byte
+		warn bool
+	}{
+		// LD V0, DT; SE V0, 0; JP 0x200; JP 0x200, waiting on a timer that never started
+		{"never set", []byte{0xF0, 0x07, 0x30, 0x00, 0x12, 0x00, 0x12, 0x00}, true},
+		// LD V0, 60; LD DT, V0; LD V1, DT; JP 0x204, with the timer running
+		{"running", []byte{0x60, 0x3C, 0xF0, 0x15, 0xF1, 0x07, 0x12, 0x04}, false},
+	} {
+		c := newTestChip8(t, tt.rom...)
+		var logged bytes.Buffer
+		c.Log = log.New(&logged, "", 0)
+		c.DelayWaitWarnFrames = 10
+
+		runFrames(t, c, 20)
+		if got := strings.Contains(logged.String(), "the delay timer has been read as zero"); got != tt.warn {
+			t.Errorf("%s: warned %v, want %v: %q", tt.name, got, tt.warn, logged.String())
+		}
+	}
+}
+
+func TestSeededRand(t *testing.T) {
+	// RND V0, 0xFF; RND V1, 0xFF
+	c := newTestChip8(t, 0xC0, 0xFF, 0xC1, 0xFF)
+	c.Rand = rand.New(rand.NewSource(42))
+	step(t, c, 2)
+	if c.V[0] != 177 || c.V[1] != 75 {
+		t.Errorf("V0=%d V1=%d with seed 42, want 177 and 75", c.V[0], c.V[1])
+	}
+}
+
+func TestRandomSource(t *testing.T) {
+	// RND V0, 0x0F; RND V1, 0x0F; RND V2, 0x0F
+	c := newTestChip8(t, 0xC0, 0x0F, 0xC1, 0x0F, 0xC2, 0x0F)
+	c.RandomSource = bytes.NewReader([]byte{0xAB, 0x70})
+	step(t, c, 2)
+	if c.V[0] != 0x0B || c.V[1] != 0x00 {
+		t.Errorf("V0=0x%02X V1=0x%02X, want 0xAB and 0x70 masked to 0x0B and 0x00", c.V[0], c.V[1])
+	}
+	if _, err := c.Step(); err == nil {
+		t.Error("no error once the random source ran out")
+	}
+}
+
+func TestReset(t *testing.T) {
+	rom := []byte{
+		0x60, 0x05, // 200: LD V0, 5
+		0xF0, 0x29, // 202: LD F, V0
+		0xF0, 0x15, // 204: LD DT, V0
+		0x22, 0x0A, // 206: CALL 0x20A
+		0x12, 0x08, // 208: JP 0x208
+		0xD0, 0x05, // 20A: DRW V0, V0, 5
+		0x00, 0xEE, // 20C: RET
+	}
+	c := newTestChip8(t, rom...)
+	step(t, c, 5)
+	if c.sp != 1 || len(setPixels(c)) == 0 {
+		t.Fatal("the ROM didn't get as far as drawing in the subroutine")
+	}
+
+	c.Reset()
+	if !bytes.Equal(c.memory[0x200:0x200+len(rom)], rom) || !bytes.Equal(c.memory[:len(Chip8Fontset)], Chip8Fontset[:]) {
+		t.Error("the ROM or the font was lost")
+	}
+	if c.V != ([16]byte{}) || c.I != 0 || c.pc != 0x200 || c.sp != 0 || c.delayTimer != 0 {
+		t.Errorf("V0=%d I=0x%03X pc=0x%03X sp=%d DT=%d after Reset, want them cleared and pc 0x200",
+			c.V[0], c.I, c.pc, c.sp, c.delayTimer)
+	}
+	if len(setPixels(c)) != 0 {
+		t.Error("the display wasn't cleared")
+	}
+}
+
+func TestLoadGameBytes(t *testing.T) {
+	full := make([]byte, 0x1000-0x200)
+	full[0], full[len(full)-1] = 0x12, 0xAB
+	tests := []struct {
+		name string
+		rom  []byte
+		ok   bool
+	}{
+		{"empty", nil, true},
+		{"exact fit", full, true},
+		{"oversized", append(full, 0), false},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, 0x60, 0x01)
+		err := c.LoadGameBytes(tt.rom)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: got error %v, want ok %v", tt.name, err, tt.ok)
+			continue
+		}
+		if tt.ok && !bytes.Equal(c.memory[0x200:0x200+len(tt.rom)], tt.rom) {
+			t.Errorf("%s: ROM not loaded at 0x200", tt.name)
+		}
+	}
+}
+
+func TestLoadGameErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		r    io.Reader
+		want string
+	}{
+		{"oversized", bytes.NewReader(make([]byte, 0xE01)), "rom is 3585 bytes, the most that fits in memory is 3584"},
+		{"erroring", iotest.ErrReader(errors.New("disk on fire")), "error reading rom: disk on fire"},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t, 0x12, 0x00)
+		err := c.LoadGame(tt.r)
+		if err == nil || err.Error() != tt.want {
+			t.Errorf("%s: got error %v, want %q", tt.name, err, tt.want)
+		}
+		if c.memory[0x200] != 0x12 || c.pc != 0x200 {
+			t.Errorf("%s: the ROM already loaded was disturbed", tt.name)
+		}
+	}
+}
+
+func TestLoadGameAuto(t *testing.T) {
+	tests := []struct {
+		name string
+		rom  []byte
+		want uint16
+	}{
+		// JP 0x604; data; LD V0, 1; JP 0x606
+		{"ETI-660", []byte{0x16, 0x04, 0xAA, 0xBB, 0x60, 0x01, 0x16, 0x06}, 0x600},
+		// JP 0x204; data; LD V0, 1; JP 0x206
+		{"0x200", []byte{0x12, 0x04, 0xAA, 0xBB, 0x60, 0x01, 0x12, 0x06}, 0x200},
+		{"no jumps", []byte{0x60, 0x01, 0x61, 0x02}, 0x200},
+	}
+	for _, tt := range tests {
+		c := newTestChip8(t)
+		start, err := c.LoadGameAuto(tt.rom)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if start != tt.want || c.pc != tt.want || !bytes.Equal(c.memory[tt.want:int(tt.want)+len(tt.rom)], tt.rom) {
+			t.Errorf("%s: loaded at 0x%03X with pc 0x%03X, want both 0x%03X", tt.name, start, c.pc, tt.want)
+		}
+	}
+}
+
+func TestBCD(t *testing.T) {
+	tests := []struct {
+		v    byte
+		want []byte
+	}{
+		{0, []byte{0, 0, 0}},
+		{9, []byte{0, 0, 9}},
+		{10, []byte{0, 1, 0}},
+		{99, []byte{0, 9, 9}},
+		{100, []byte{1, 0, 0}},
+		{255, []byte{2, 5, 5}},
+	}
+	for _, tt := range tests {
+		// LD V3, v; LD I, 0x300; LD B, V3
+		c := newTestChip8(t, 0x63, tt.v, 0xA3, 0x00, 0xF3, 0x33)
+		step(t, c, 3)
+		if got := c.memory[0x300:0x303]; !bytes.Equal(got, tt.want) {
+			t.Errorf("BCD of %d is % d, want % d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestBCDOfVF(t *testing.T) {
+	// LD VF, 123; LD I, 0x300; LD B, VF
+	c := newTestChip8(t, 0x6F, 0x7B, 0xA3, 0x00, 0xFF, 0x33)
+	step(t, c, 3)
+	if got := c.memory[0x300:0x303]; !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Errorf("BCD of VF is % d, want 1 2 3", got)
+	}
+	if c.V[0xF] != 123 || c.I != 0x300 {
+		t.Errorf("VF=%d I=0x%03X after FF33, want both left alone", c.V[0xF], c.I)
+	}
+
+	c = newTestChip8(t, 0x6F, 0x7B, 0xAF, 0xFE, 0xFF, 0x33)
+	step(t, c, 2)
+	if _, err := c.Step(); err == nil {
+		t.Error("FX33 at 0xFFE didn't fail, want the write past the end of memory caught")
+	}
+}
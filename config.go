@@ -0,0 +1,597 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image/color"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Config holds the user tunable settings of the emulator. It's embedded in Chip8 so the
+// fields can be set directly on a machine, or loaded from a sidecar file with ParseConfig.
+type Config struct {
+	// ClockHz is the number of instructions executed per second, 540 if it isn't positive.
+	// The timers run at 60Hz regardless.
+	ClockHz int
+
+	// Accuracy is the platform the quirks were last set up for, see SetAccuracy
+	Accuracy Accuracy
+	Quirks   Quirks
+
+	// Colors used by the terminal renderer for set and unset pixels.
+	ForegroundColor termbox.Attribute
+	BackgroundColor termbox.Attribute
+
+	// PixelScale draws each pixel as a PixelScale x PixelScale block of terminal cells, as far
+	// as the terminal has room for. Zero is the same as 1.
+	PixelScale int
+
+	// Brightness scales how bright set pixels are, from 0 to 1, and Gamma is the gamma
+	// correction applied to partly lit pixels. See Intensity.
+	Brightness float64
+	Gamma      float64
+
+	// MaxFrameSkip lets up to this many frames in a row go unrendered when the terminal can't
+	// keep up, so the game doesn't slow down. The CPU and timers still run every frame. Zero
+	// renders every change as soon as it's made.
+	MaxFrameSkip int
+
+	// RefreshHz is the most times a second the terminal is redrawn. Changes made in between
+	// are held back and shown together in the next redraw, which saves flushing the whole
+	// display for every sprite on a slow terminal. Zero redraws on every change.
+	RefreshHz int
+
+	// ScreenshotScale is how many pixels across and down each display pixel takes up in a
+	// Screenshot, and ScreenshotForeground and ScreenshotBackground the colours of set and
+	// unset pixels.
+	ScreenshotScale      int
+	ScreenshotForeground color.RGBA
+	ScreenshotBackground color.RGBA
+
+	// KeyProfile is the keyboard layout used for the keypad.
+	KeyProfile KeyProfile
+
+	// ShowKeypad draws the keypad below the display, highlighting the keys that are down.
+	ShowKeypad bool
+
+	// ShowStatus draws a status line below the display with the ROM name, speed and state.
+	ShowStatus bool
+
+	// ShowBeep flashes a note to the right of the display while the sound timer is running,
+	// for anyone who can't hear the beep.
+	ShowBeep bool
+
+	// NoDrawWarnFrames is how many frames may pass without anything being drawn before a
+	// warning is logged. Zero disables the warning.
+	NoDrawWarnFrames int
+
+	// DelayWaitWarnFrames is how many frames a ROM may spin reading a delay timer that's zero
+	// and never set before a warning is logged. Zero disables the warning.
+	DelayWaitWarnFrames int
+
+	// MinSoundTimer is the smallest value FX18 can set the sound timer to that makes a sound.
+	// The COSMAC VIP ignores a value of 1, for example, so 2 would match it. Zero means every
+	// value beeps.
+	MinSoundTimer int
+
+	// DrawMode controls how DXYN combines sprites with the display.
+	DrawMode DrawMode
+
+	// WrapSprites makes the parts of a sprite that run off the edge of the display wrap
+	// around to the other side, instead of being clipped.
+	WrapSprites bool
+
+	// Font is the built in font loaded into memory by Initialize.
+	Font Font
+
+	// TrapVFWrites logs a warning whenever an opcode that doesn't set flags (e.g. 6FNN or
+	// 8FY0) overwrites VF, to help track down flag clobbering bugs.
+	TrapVFWrites bool
+
+	// TrapSelfModify logs a warning the first time the program writes to each address it has
+	// already executed code from.
+	TrapSelfModify bool
+
+	// TrapSpriteOverread logs a warning when DXYN reads sprite rows from memory that has been
+	// executed as code, which usually means the sprite height runs past the end of its data.
+	// Sometimes it's intentional, so it's only a warning.
+	TrapSpriteOverread bool
+
+	// PauseOnError pauses on an instruction that fails, rather than returning the error, so
+	// it can be looked at in the debugger. See Chip8.Fault.
+	PauseOnError bool
+
+	// UndoDepth is how many instructions are logged so StepBackOne can reverse them. Zero
+	// turns the log off, so it costs nothing.
+	UndoDepth int
+
+	// TraceDepth is how many of the most recently executed instructions are kept, to be
+	// logged when an instruction fails. Zero turns the trace off.
+	TraceDepth int
+
+	// BankSwitching allows ROM images bigger than memory, with 01NN selecting which 2KB bank
+	// is mapped into the upper half of memory. The first 0x600 bytes of the image are always
+	// at 0x200, and the banks follow them in order, so bank 0 starts at 0x600 in the file and
+	// bank N at 0x600 + N*0x800. It must be set before the ROM is loaded.
+	BankSwitching bool
+
+	// PlaylistDuration is how long each ROM in a playlist runs for, in emulated time, before
+	// moving on to the next. A ROM that halts is moved on from straight away.
+	PlaylistDuration time.Duration
+}
+
+// Quirks toggles behaviours that differ between CHIP-8 interpreters.
+type Quirks struct {
+	// ShiftUsesVY makes 8XY6/8XYE shift VY into VX, rather than shifting VX in place.
+	ShiftUsesVY bool
+
+	// LogicResetsVF makes 8XY1/8XY2/8XY3 reset VF to 0.
+	LogicResetsVF bool
+
+	// DisplayWait stops execution after each DXYN until the next frame, as the COSMAC VIP
+	// waited for the vertical blank before drawing.
+	DisplayWait bool
+
+	// LoadStoreIncrementsI makes FX55/FX65 leave I pointing just past the last register
+	// transferred, as the original COSMAC VIP interpreter did.
+	LoadStoreIncrementsI bool
+
+	// ResolutionChangeClears clears the display when 00FE/00FF switch resolution. Without
+	// it the current picture is scaled to the new resolution.
+	ResolutionChangeClears bool
+
+	// DelayTimerLatency makes FX07 read the delay timer as it was a cycle earlier, so a read
+	// straight after the timer ticks still sees the old value, as on the COSMAC VIP. Tight
+	// timing loops can depend on it.
+	DelayTimerLatency bool
+
+	// SCHIPInstructions runs the SUPER-CHIP instructions: the 00CN/00FB/00FC scrolls, 00FD,
+	// the 00FE/00FF resolution switches, FX30 and the FX75/FX85 RPL flags. Without it they're
+	// unknown opcodes, as they were on the COSMAC VIP.
+	SCHIPInstructions bool
+
+	// LargeSprites makes DXY0 draw a 16x16 sprite in hi-res, as SCHIP does. In low-res, or
+	// without it, DXY0 is a zero height sprite and draws nothing.
+	LargeSprites bool
+
+	// JumpUsesVX makes BNNN jump to XNN plus VX, with X the top digit of the address, as
+	// SCHIP does. Without it the jump is to NNN plus V0.
+	JumpUsesVX bool
+
+	// FX1EOverflowFlag makes FX1E set VF to 1 when I goes past 0xFFF, and to 0 when it
+	// doesn't, as the Amiga interpreter did. Spacefight 2091! depends on it. No platform
+	// turns it on by default.
+	FX1EOverflowFlag bool
+}
+
+// DrawMode is how sprites are combined with what's already on the display.
+type DrawMode int
+
+const (
+	// DrawXOR flips pixels, as standard CHIP-8 does, so drawing a sprite twice erases it.
+	DrawXOR DrawMode = iota
+	// DrawOR only ever sets pixels. Nothing is erased, which also means there are no
+	// collisions and VF is always 0 after DXYN.
+	DrawOR
+)
+
+var drawModeNames = map[string]DrawMode{
+	"xor": DrawXOR,
+	"or":  DrawOR,
+}
+
+// Font selects one of the built in fonts. They only differ in the shapes of a few digits.
+type Font int
+
+const (
+	// FontSCHIP is the font from SUPER-CHIP, which most emulators use.
+	FontSCHIP Font = iota
+	// FontVIP is the font from the original COSMAC VIP interpreter.
+	FontVIP
+	// FontOcto is the font used by Octo.
+	FontOcto
+)
+
+var fontNames = map[string]Font{
+	"schip": FontSCHIP,
+	"vip":   FontVIP,
+	"octo":  FontOcto,
+}
+
+// KeyProfile selects one of the built in keyboard layouts.
+type KeyProfile int
+
+const (
+	// KeysClassic maps 1234/QWER/ASDF/ZXCV onto the keys 0 to F.
+	KeysClassic KeyProfile = iota
+	// KeysModern uses the arrow keys for 5/7/8/9, with space and enter for 6 and 4, and the
+	// hex digits for themselves.
+	KeysModern
+)
+
+var keyProfileNames = map[string]KeyProfile{
+	"classic": KeysClassic,
+	"modern":  KeysModern,
+}
+
+// Accuracy selects a platform to match, each with its own set of quirks.
+type Accuracy int
+
+const (
+	// AccuracyModern is the behaviour most present day ROMs and emulators expect.
+	AccuracyModern Accuracy = iota
+	// AccuracyVIP matches the original COSMAC VIP interpreter.
+	AccuracyVIP
+	// AccuracySCHIP matches SUPER-CHIP 1.1 on the HP48, the original "legacy" SCHIP.
+	AccuracySCHIP
+	// AccuracyXOCHIP matches XO-CHIP as implemented by Octo.
+	AccuracyXOCHIP
+	// AccuracySCHIPModern matches SUPER-CHIP as modern interpreters run it, per the quirks test in
+	// Timendus' CHIP-8 test suite: like SCHIP 1.1, shifts work on VX in place and load/store
+	// leaves I alone, but changing resolution clears the display.
+	AccuracySCHIPModern
+)
+
+var accuracyNames = map[string]Accuracy{
+	"modern":       AccuracyModern,
+	"vip":          AccuracyVIP,
+	"schip":        AccuracySCHIP,
+	"schip_legacy": AccuracySCHIP,
+	"schip_modern": AccuracySCHIPModern,
+	"xochip":       AccuracyXOCHIP,
+}
+
+// Quirks returns the full set of quirks for the platform.
+func (a Accuracy) Quirks() Quirks {
+	switch a {
+	case AccuracyVIP:
+		return Quirks{
+			ShiftUsesVY:            true,
+			LogicResetsVF:          true,
+			DisplayWait:            true,
+			LoadStoreIncrementsI:   true,
+			ResolutionChangeClears: true,
+			DelayTimerLatency:      true,
+		}
+	case AccuracySCHIP:
+		return Quirks{
+			SCHIPInstructions: true,
+			LargeSprites:      true,
+			JumpUsesVX:        true,
+		}
+	case AccuracySCHIPModern:
+		return Quirks{
+			ResolutionChangeClears: true,
+			SCHIPInstructions:      true,
+			LargeSprites:           true,
+			JumpUsesVX:             true,
+		}
+	case AccuracyXOCHIP:
+		return Quirks{
+			ShiftUsesVY:            true,
+			LoadStoreIncrementsI:   true,
+			ResolutionChangeClears: true,
+			SCHIPInstructions:      true,
+			LargeSprites:           true,
+		}
+	default:
+		return Quirks{
+			ResolutionChangeClears: true,
+			SCHIPInstructions:      true,
+			LargeSprites:           true,
+		}
+	}
+}
+
+// SetAccuracy replaces all the quirks with the defaults for a platform. Individual quirks
+// can still be changed afterwards.
+func (cfg *Config) SetAccuracy(a Accuracy) {
+	cfg.Accuracy = a
+	cfg.Quirks = a.Quirks()
+}
+
+// defaultClockHz is the clock rate used when none is configured.
+const defaultClockHz = 540
+
+// DefaultConfig returns the settings used when nothing else is specified.
+func DefaultConfig() Config {
+	return Config{
+		ClockHz:         defaultClockHz,
+		Accuracy:        AccuracyModern,
+		Quirks:          AccuracyModern.Quirks(),
+		ForegroundColor: termbox.ColorWhite,
+		BackgroundColor: termbox.ColorBlack,
+		Brightness:      1,
+		Gamma:           1,
+
+		ScreenshotScale:      8,
+		ScreenshotForeground: color.RGBA{0xFF, 0xFF, 0xFF, 0xFF},
+		ScreenshotBackground: color.RGBA{0x00, 0x00, 0x00, 0xFF},
+
+		NoDrawWarnFrames:    300, // 5 seconds
+		DelayWaitWarnFrames: 120, // 2 seconds
+		PlaylistDuration:    30 * time.Second,
+		TraceDepth:          16,
+	}
+}
+
+// quirkFlags maps the config file name of each quirk to its field.
+func (q *Quirks) quirkFlags() map[string]*bool {
+	return map[string]*bool{
+		"shift_uses_vy":            &q.ShiftUsesVY,
+		"logic_resets_vf":          &q.LogicResetsVF,
+		"display_wait":             &q.DisplayWait,
+		"load_store_increments_i":  &q.LoadStoreIncrementsI,
+		"resolution_change_clears": &q.ResolutionChangeClears,
+		"delay_timer_latency":      &q.DelayTimerLatency,
+		"schip_instructions":       &q.SCHIPInstructions,
+		"large_sprites":            &q.LargeSprites,
+		"jump_uses_vx":             &q.JumpUsesVX,
+		"fx1e_overflow_flag":       &q.FX1EOverflowFlag,
+	}
+}
+
+var colorNames = map[string]termbox.Attribute{
+	"default": termbox.ColorDefault,
+	"black":   termbox.ColorBlack,
+	"red":     termbox.ColorRed,
+	"green":   termbox.ColorGreen,
+	"yellow":  termbox.ColorYellow,
+	"blue":    termbox.ColorBlue,
+	"magenta": termbox.ColorMagenta,
+	"cyan":    termbox.ColorCyan,
+	"white":   termbox.ColorWhite,
+}
+
+// ParseConfig reads settings in a simple key=value format, one per line, and applies them
+// on top of cfg. Blank lines and lines starting with # are ignored. For example:
+//
+//	clock_hz = 700
+//	accuracy = vip
+//	load_store_increments_i = false
+//	foreground = green
+func ParseConfig(r io.Reader, cfg *Config) error {
+	type setting struct {
+		line       int
+		key, value string
+	}
+
+	// The accuracy setting replaces all the quirks, so it's applied first wherever it appears
+	// in the file. That way individual quirks always override it.
+	var accuracy, settings []setting
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("line %d: expected key=value, got %q", line, text)
+		}
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		if key == "accuracy" {
+			accuracy = append(accuracy, setting{line, key, value})
+		} else {
+			settings = append(settings, setting{line, key, value})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	for _, s := range append(accuracy, settings...) {
+		if err := cfg.set(s.key, s.value); err != nil {
+			return fmt.Errorf("line %d: %v", s.line, err)
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) set(key, value string) error {
+	if flag, ok := cfg.Quirks.quirkFlags()[key]; ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		*flag = b
+		return nil
+	}
+
+	switch key {
+	case "accuracy":
+		a, ok := accuracyNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown accuracy %q", value)
+		}
+		cfg.SetAccuracy(a)
+
+	case "clock_hz":
+		hz, err := strconv.Atoi(value)
+		if err != nil || hz <= 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.ClockHz = hz
+
+	case "nodraw_warn_frames":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.NoDrawWarnFrames = n
+
+	case "undo_depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.UndoDepth = n
+
+	case "trace_depth":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.TraceDepth = n
+
+	case "brightness", "gamma":
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || f < 0 || (key == "brightness" && f > 1) || (key == "gamma" && f == 0) {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		if key == "brightness" {
+			cfg.Brightness = f
+		} else {
+			cfg.Gamma = f
+		}
+
+	case "min_sound_timer":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 || n > 0xFF {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.MinSoundTimer = n
+
+	case "max_frame_skip":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.MaxFrameSkip = n
+
+	case "refresh_hz":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.RefreshHz = n
+
+	case "pixel_scale":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.PixelScale = n
+
+	case "screenshot_scale":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.ScreenshotScale = n
+
+	case "screenshot_foreground", "screenshot_background":
+		rgb, err := strconv.ParseUint(strings.TrimPrefix(value, "#"), 16, 24)
+		if err != nil || len(strings.TrimPrefix(value, "#")) != 6 {
+			return fmt.Errorf("invalid color for %s, expected #RRGGBB: %q", key, value)
+		}
+		c := color.RGBA{byte(rgb >> 16), byte(rgb >> 8), byte(rgb), 0xFF}
+		if key == "screenshot_foreground" {
+			cfg.ScreenshotForeground = c
+		} else {
+			cfg.ScreenshotBackground = c
+		}
+
+	case "playlist_duration":
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.PlaylistDuration = d
+
+	case "keys":
+		p, ok := keyProfileNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown key profile %q", value)
+		}
+		cfg.KeyProfile = p
+
+	case "font":
+		font, ok := fontNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown font %q", value)
+		}
+		cfg.Font = font
+
+	case "delay_wait_warn_frames":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		cfg.DelayWaitWarnFrames = n
+
+	case "draw_mode":
+		mode, ok := drawModeNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown draw mode %q", value)
+		}
+		cfg.DrawMode = mode
+
+	case "trap_vf_writes", "trap_self_modify", "trap_sprite_overread", "show_keypad", "show_status", "show_beep", "bank_switching", "pause_on_error", "wrap_sprites":
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value for %s: %q", key, value)
+		}
+		switch key {
+		case "trap_vf_writes":
+			cfg.TrapVFWrites = b
+		case "trap_self_modify":
+			cfg.TrapSelfModify = b
+		case "trap_sprite_overread":
+			cfg.TrapSpriteOverread = b
+		case "show_keypad":
+			cfg.ShowKeypad = b
+		case "show_status":
+			cfg.ShowStatus = b
+		case "show_beep":
+			cfg.ShowBeep = b
+		case "bank_switching":
+			cfg.BankSwitching = b
+		case "pause_on_error":
+			cfg.PauseOnError = b
+		case "wrap_sprites":
+			cfg.WrapSprites = b
+		}
+
+	case "foreground", "background":
+		attr, ok := colorNames[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unknown color for %s: %q", key, value)
+		}
+		if key == "foreground" {
+			cfg.ForegroundColor = attr
+		} else {
+			cfg.BackgroundColor = attr
+		}
+
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	return nil
+}
+
+// LoadConfigFile applies the settings in the file at path on top of cfg. If the file doesn't
+// exist the returned error satisfies os.IsNotExist.
+func LoadConfigFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := ParseConfig(f, cfg); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
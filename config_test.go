@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+func TestParseConfig(t *testing.T) {
+	const file = `
+# per game settings
+clock_hz = 700
+load_store_increments_i = false
+FOREGROUND = green
+accuracy = vip
+`
+	// LD I, 0x300; LD [I], V1
+	c := newTestChip8(t, 0xA3, 0x00, 0xF1, 0x55)
+	if err := ParseConfig(strings.NewReader(file), &c.Config); err != nil {
+		t.Fatal(err)
+	}
+
+	if c.ClockHz != 700 || c.ForegroundColor != termbox.ColorGreen || c.Accuracy != AccuracyVIP {
+		t.Errorf("clock %d, foreground %v, accuracy %v, want 700, green and vip", c.ClockHz, c.ForegroundColor, c.Accuracy)
+	}
+	// The rest of the VIP quirks apply, except the one overridden, even though it came first
+	if !c.Quirks.ShiftUsesVY || !c.Quirks.DisplayWait || c.Quirks.LoadStoreIncrementsI {
+		t.Errorf("quirks %+v, want the VIP's without load_store_increments_i", c.Quirks)
+	}
+	step(t, c, 2)
+	if c.I != 0x300 {
+		t.Errorf("I = 0x%03X after FX55, want it left at 0x300", c.I)
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	for _, file := range []string{
+		"clock_hz",
+		"clock_hz = fast",
+		"clock_hz = 0",
+		"accuracy = amiga",
+		"display_wait = sometimes",
+		"foreground = puce",
+		"no_such_setting = 1",
+	} {
+		cfg := DefaultConfig()
+		if err := ParseConfig(strings.NewReader("# ok\n"+file), &cfg); err == nil {
+			t.Errorf("%q: no error", file)
+		} else if !strings.HasPrefix(err.Error(), "line 2: ") {
+			t.Errorf("%q: error %q doesn't give the line", file, err)
+		}
+	}
+}
+
+func TestParseConfigSwitches(t *testing.T) {
+	for key, field := range map[string]func(*Config) bool{
+		"trap_vf_writes":       func(cfg *Config) bool { return cfg.TrapVFWrites },
+		"trap_self_modify":     func(cfg *Config) bool { return cfg.TrapSelfModify },
+		"trap_sprite_overread": func(cfg *Config) bool { return cfg.TrapSpriteOverread },
+		"show_keypad":          func(cfg *Config) bool { return cfg.ShowKeypad },
+		"show_status":          func(cfg *Config) bool { return cfg.ShowStatus },
+		"show_beep":            func(cfg *Config) bool { return cfg.ShowBeep },
+		"bank_switching":       func(cfg *Config) bool { return cfg.BankSwitching },
+		"pause_on_error":       func(cfg *Config) bool { return cfg.PauseOnError },
+		"wrap_sprites":         func(cfg *Config) bool { return cfg.WrapSprites },
+	} {
+		for _, b := range []bool{true, false} {
+			cfg := DefaultConfig()
+			want := cfg
+			if err := ParseConfig(strings.NewReader(fmt.Sprintf("%s = %v", key, b)), &cfg); err != nil {
+				t.Fatalf("%s: %v", key, err)
+			}
+			if field(&cfg) != b {
+				t.Errorf("%s = %v didn't set it", key, b)
+			}
+			// Put the field back, to check nothing else changed
+			if err := ParseConfig(strings.NewReader(fmt.Sprintf("%s = %v", key, field(&want))), &cfg); err != nil {
+				t.Fatalf("%s: %v", key, err)
+			}
+			if !reflect.DeepEqual(cfg, want) {
+				t.Errorf("%s = %v changed other settings too", key, b)
+			}
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "game.ch8.cfg")
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, &cfg); !os.IsNotExist(err) {
+		t.Errorf("missing file: error %v, want one that satisfies os.IsNotExist", err)
+	}
+
+	if err := os.WriteFile(path, []byte("clock_hz = 1000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.ClockHz != 1000 {
+		t.Errorf("clock %d, want 1000 from the file", cfg.ClockHz)
+	}
+}
+
+func TestAccuracyVIP(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SetAccuracy(AccuracyVIP)
+	q := cfg.Quirks
+	if !q.ShiftUsesVY || !q.LogicResetsVF || !q.DisplayWait || !q.LoadStoreIncrementsI {
+		t.Errorf("VIP quirks %+v, want shift uses VY, logic resets VF, display wait and load/store increments I", q)
+	}
+
+	// An individual quirk still overrides the preset
+	cfg = DefaultConfig()
+	if err := ParseConfig(strings.NewReader("display_wait = false\naccuracy = VIP\n"), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if q := cfg.Quirks; !q.ShiftUsesVY || !q.LogicResetsVF || q.DisplayWait || !q.LoadStoreIncrementsI {
+		t.Errorf("VIP quirks with display wait turned off %+v", q)
+	}
+}
+
+func TestSCHIPPresets(t *testing.T) {
+	tests := []struct {
+		accuracy               Accuracy
+		resolutionChangeClears bool
+	}{
+		{AccuracySCHIP, false},
+		{AccuracySCHIPModern, true},
+	}
+	for _, tt := range tests {
+		q := tt.accuracy.Quirks()
+		// Both shift VX in place and leave I alone on load/store
+		if q.ShiftUsesVY || q.LoadStoreIncrementsI {
+			t.Errorf("accuracy %v: shift uses VY %v, load/store increments I %v, want neither",
+				tt.accuracy, q.ShiftUsesVY, q.LoadStoreIncrementsI)
+		}
+		if q.ResolutionChangeClears != tt.resolutionChangeClears {
+			t.Errorf("accuracy %v: resolution change clears %v, want %v", tt.accuracy, q.ResolutionChangeClears, tt.resolutionChangeClears)
+		}
+		if !q.SCHIPInstructions || !q.LargeSprites || !q.JumpUsesVX {
+			t.Errorf("accuracy %v: quirks %+v, want the SUPER-CHIP instructions, large sprites and BXNN", tt.accuracy, q)
+		}
+	}
+
+	for name, want := range map[string]Accuracy{"schip": AccuracySCHIP, "schip_legacy": AccuracySCHIP, "schip_modern": AccuracySCHIPModern} {
+		cfg := DefaultConfig()
+		if err := ParseConfig(strings.NewReader("accuracy = "+name), &cfg); err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Accuracy != want || cfg.Quirks != want.Quirks() {
+			t.Errorf("accuracy = %s: got %v with %+v, want %v", name, cfg.Accuracy, cfg.Quirks, want)
+		}
+	}
+}
@@ -0,0 +1,548 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Peek returns the byte of memory at addr.
+func (c *Chip8) Peek(addr uint16) (byte, error) {
+	if int(addr) >= len(c.memory) {
+		return 0, fmt.Errorf("address 0x%X is out of range", addr)
+	}
+	return c.memory[addr], nil
+}
+
+// Poke sets the byte of memory at addr.
+func (c *Chip8) Poke(addr uint16, b byte) error {
+	if int(addr) >= len(c.memory) {
+		return fmt.Errorf("address 0x%X is out of range", addr)
+	}
+	c.memory[addr] = b
+	return nil
+}
+
+// ReadMemory returns a copy of the n bytes of memory starting at addr.
+func (c *Chip8) ReadMemory(addr uint16, n int) ([]byte, error) {
+	if n < 0 || int(addr)+n > len(c.memory) {
+		return nil, fmt.Errorf("%d bytes at 0x%X is out of range", n, addr)
+	}
+	return append([]byte(nil), c.memory[addr:int(addr)+n]...), nil
+}
+
+// Register returns the value of register VX.
+func (c *Chip8) Register(x int) (byte, error) {
+	if x < 0 || x >= len(c.V) {
+		return 0, fmt.Errorf("register %d is out of range, there are only V0 to VF", x)
+	}
+	return c.V[x], nil
+}
+
+// SetRegister sets register VX.
+func (c *Chip8) SetRegister(x int, b byte) error {
+	if x < 0 || x >= len(c.V) {
+		return fmt.Errorf("register %d is out of range, there are only V0 to VF", x)
+	}
+	c.V[x] = b
+	return nil
+}
+
+// RegisterDump returns the values of V0 to VF.
+func (c *Chip8) RegisterDump() [16]byte {
+	return c.V
+}
+
+// CurrentOpcode returns the opcode at pc, which will be executed next, without changing
+// anything. Any part of the opcode that falls past the end of memory reads as zero.
+func (c *Chip8) CurrentOpcode() uint16 {
+	var opcode uint16
+	if int(c.pc) < len(c.memory) {
+		opcode = uint16(c.memory[c.pc]) << 8
+	}
+	if int(c.pc)+1 < len(c.memory) {
+		opcode |= uint16(c.memory[c.pc+1])
+	}
+	return opcode
+}
+
+// PC returns the address of the next instruction to execute.
+func (c *Chip8) PC() uint16 {
+	return c.pc
+}
+
+// SP returns how many calls are on the stack.
+func (c *Chip8) SP() uint16 {
+	return c.sp
+}
+
+// DelayTimer returns the current value of the delay timer.
+func (c *Chip8) DelayTimer() uint8 {
+	return c.delayTimer
+}
+
+// SoundTimer returns the current value of the sound timer.
+func (c *Chip8) SoundTimer() uint8 {
+	return c.soundTimer
+}
+
+// SetPC moves execution to addr, which must be even and leave room for a whole instruction
+// before the end of memory.
+func (c *Chip8) SetPC(addr uint16) error {
+	if int(addr)+1 >= len(c.memory) {
+		return fmt.Errorf("address 0x%X is out of range", addr)
+	}
+	if addr%2 != 0 {
+		return fmt.Errorf("address 0x%X isn't aligned to an instruction", addr)
+	}
+	c.pc = addr
+	return nil
+}
+
+type opcodeBreak struct {
+	pattern, mask uint16
+}
+
+// BreakAt pauses emulation just before the instruction at addr executes.
+func (c *Chip8) BreakAt(addr uint16) error {
+	if int(addr) >= len(c.memory) {
+		return fmt.Errorf("address 0x%X is out of range", addr)
+	}
+	if c.breakpoints == nil {
+		c.breakpoints = make(map[uint16]bool)
+	}
+	c.breakpoints[addr] = true
+	return nil
+}
+
+// BreakOnOpcode pauses emulation just before any instruction matching pattern executes,
+// wherever it is. Only the bits set in mask are compared, so BreakOnOpcode(0xD000, 0xF000)
+// stops on every sprite draw.
+func (c *Chip8) BreakOnOpcode(pattern, mask uint16) {
+	c.opcodeBreaks = append(c.opcodeBreaks, opcodeBreak{pattern: pattern & mask, mask: mask})
+}
+
+// ClearBreakpoints removes all address and opcode breakpoints.
+func (c *Chip8) ClearBreakpoints() {
+	c.breakpoints = nil
+	c.opcodeBreaks = nil
+}
+
+// Pause stops execution, along with the timers, until Resume is called. What's on the display
+// stays there, and EmulateCycle and Run carry on drawing it.
+func (c *Chip8) Pause() {
+	c.Paused = true
+}
+
+// Resume carries on after a pause, starting with the instruction a breakpoint stopped on.
+func (c *Chip8) Resume() {
+	if c.Paused {
+		c.Paused = false
+		c.skipBreak = true
+		c.fault = nil
+	}
+}
+
+// Fault returns the error that paused the machine with Config.PauseOnError set, or nil. pc
+// is left on the instruction that failed.
+func (c *Chip8) Fault() error {
+	return c.fault
+}
+
+// SkipFault moves past the instruction that failed, leaving the machine paused.
+func (c *Chip8) SkipFault() {
+	if c.fault != nil {
+		c.fault = nil
+		c.pc += 2
+	}
+}
+
+func (c *Chip8) shouldBreak(opcode uint16) bool {
+	if c.breakpoints[c.pc] {
+		return true
+	}
+	for _, b := range c.opcodeBreaks {
+		if opcode&b.mask == b.pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// step executes one instruction whether or not the machine is paused, without stopping on
+// a breakpoint at the current address.
+func (c *Chip8) step() error {
+	paused := c.Paused
+	c.Paused = false
+	c.skipBreak = true
+	c.fault = nil
+	err := c.cycle()
+	c.Paused = c.Paused || paused
+	if err == nil {
+		err = c.fault
+	}
+	return err
+}
+
+// Instruction describes an instruction run by Step.
+type Instruction struct {
+	// PC is the address the instruction was fetched from
+	PC       uint16
+	Opcode   uint16
+	Mnemonic string
+	// The operand fields of the opcode. They're all filled in, whether or not the instruction
+	// uses them.
+	X, Y, N uint8
+	NN      uint8
+	NNN     uint16
+}
+
+// decodeInstruction splits the opcode at pc into its fields.
+func decodeInstruction(pc, opcode uint16) Instruction {
+	asm, _ := Mnemonic(opcode)
+	return Instruction{
+		PC:       pc,
+		Opcode:   opcode,
+		Mnemonic: asm,
+		X:        uint8((opcode & 0x0F00) >> 8),
+		Y:        uint8((opcode & 0x00F0) >> 4),
+		N:        uint8(opcode & 0x000F),
+		NN:       uint8(opcode & 0x00FF),
+		NNN:      opcode & 0x0FFF,
+	}
+}
+
+// Step runs the next instruction, even if the machine is paused or there's a breakpoint on it,
+// and returns what it was. The machine is left paused if it was before.
+func (c *Chip8) Step() (Instruction, error) {
+	inst := decodeInstruction(c.pc, c.CurrentOpcode())
+	return inst, c.step()
+}
+
+// StackFrame is one level of the call stack.
+type StackFrame struct {
+	// Return is the address execution continues from once the subroutine returns
+	Return uint16
+	// Entry is the address of the subroutine that was called
+	Entry uint16
+}
+
+// Stack returns the return addresses currently on the call stack, outermost call first.
+func (c *Chip8) Stack() []uint16 {
+	addrs := make([]uint16, c.sp)
+	copy(addrs, c.stack[:c.sp])
+	return addrs
+}
+
+// StackFrames is like Stack, but also includes the entry point of each subroutine.
+func (c *Chip8) StackFrames() []StackFrame {
+	frames := make([]StackFrame, c.sp)
+	for i := range frames {
+		frames[i] = StackFrame{Return: c.stack[i], Entry: c.callTargets[i]}
+	}
+	return frames
+}
+
+const debugHelp = `commands (numbers are hex, the 0x prefix is optional):
+  regs                 show the registers
+  stack                show the call stack
+  peek <addr> [count]  show count bytes of memory from addr
+  poke <addr> <byte>   set the byte at addr
+  set <reg> <byte>     set register V0 to VF
+  edit <addr>          enter bytes to write from addr, a blank line finishes
+  step [count]         execute count instructions
+  back [count]         reverse the last count instructions, see undo_depth
+  jump <addr>          continue execution from addr
+  skip                 skip over the instruction that failed
+  break <addr>         pause before the instruction at addr
+  breakop <op> <mask>  pause before any opcode where opcode&mask == op
+  clear                remove all breakpoints
+  continue             leave the debugger and carry on running
+  quit                 leave the debugger and stop
+`
+
+// Debugger is a simple line based REPL for inspecting and modifying a paused machine.
+type Debugger struct {
+	c   *Chip8
+	out io.Writer
+
+	// While editing, each line of input is written to memory from editAddr onwards
+	editing  bool
+	editAddr uint16
+}
+
+func NewDebugger(c *Chip8, out io.Writer) *Debugger {
+	return &Debugger{c: c, out: out}
+}
+
+// Run reads and executes commands from r until the user asks to continue or quit. resume
+// reports which one it was; reaching the end of the input counts as quitting.
+func (d *Debugger) Run(r io.Reader) (resume bool, err error) {
+	if err := d.c.Fault(); err != nil {
+		fmt.Fprintf(d.out, "stopped on error at 0x%03X: %v\n", d.c.pc, err)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for {
+		d.prompt()
+		if !scanner.Scan() {
+			return false, scanner.Err()
+		}
+
+		done, resume, err := d.Exec(scanner.Text())
+		if err != nil {
+			fmt.Fprintf(d.out, "error: %v\n", err)
+		}
+		if done {
+			return resume, nil
+		}
+	}
+}
+
+func (d *Debugger) prompt() {
+	if d.editing {
+		fmt.Fprintf(d.out, "edit 0x%03X> ", d.editAddr)
+	} else {
+		fmt.Fprint(d.out, "> ")
+	}
+}
+
+// Exec runs a single line of input. done is true once the user has asked to leave the
+// debugger, with resume saying whether emulation should carry on.
+func (d *Debugger) Exec(line string) (done, resume bool, err error) {
+	fields := strings.Fields(line)
+
+	if d.editing {
+		if len(fields) == 0 {
+			d.editing = false
+			return false, false, nil
+		}
+		for _, field := range fields {
+			b, err := parseByte(field)
+			if err != nil {
+				return false, false, err
+			}
+			if err := d.c.Poke(d.editAddr, b); err != nil {
+				d.editing = false
+				return false, false, err
+			}
+			d.editAddr++
+		}
+		return false, false, nil
+	}
+
+	if len(fields) == 0 {
+		return false, false, nil
+	}
+
+	args := fields[1:]
+	switch fields[0] {
+	case "help", "?":
+		fmt.Fprint(d.out, debugHelp)
+
+	case "regs":
+		d.printRegisters()
+
+	case "stack":
+		frames := d.c.StackFrames()
+		if len(frames) == 0 {
+			fmt.Fprintln(d.out, "stack is empty")
+		}
+		for i := len(frames) - 1; i >= 0; i-- {
+			fmt.Fprintf(d.out, "#%d sub 0x%03X, returns to 0x%03X\n", i, frames[i].Entry, frames[i].Return)
+		}
+
+	case "peek":
+		if len(args) < 1 || len(args) > 2 {
+			return false, false, fmt.Errorf("usage: peek <addr> [count]")
+		}
+		addr, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		count := uint16(1)
+		if len(args) == 2 {
+			if count, err = parseAddr(args[1]); err != nil {
+				return false, false, err
+			}
+		}
+		return false, false, d.printMemory(addr, count)
+
+	case "poke":
+		if len(args) != 2 {
+			return false, false, fmt.Errorf("usage: poke <addr> <byte>")
+		}
+		addr, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		b, err := parseByte(args[1])
+		if err != nil {
+			return false, false, err
+		}
+		return false, false, d.c.Poke(addr, b)
+
+	case "set":
+		if len(args) != 2 {
+			return false, false, fmt.Errorf("usage: set <reg> <byte>")
+		}
+		reg, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(args[0]), "v"), 16, 8)
+		if err != nil {
+			return false, false, fmt.Errorf("invalid register %q", args[0])
+		}
+		b, err := parseByte(args[1])
+		if err != nil {
+			return false, false, err
+		}
+		return false, false, d.c.SetRegister(int(reg), b)
+
+	case "edit":
+		if len(args) != 1 {
+			return false, false, fmt.Errorf("usage: edit <addr>")
+		}
+		addr, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		if _, err := d.c.Peek(addr); err != nil {
+			return false, false, err
+		}
+		d.editing = true
+		d.editAddr = addr
+
+	case "step":
+		count := uint16(1)
+		if len(args) == 1 {
+			if count, err = parseAddr(args[0]); err != nil {
+				return false, false, err
+			}
+		}
+		for i := uint16(0); i < count; i++ {
+			inst, err := d.c.Step()
+			if err != nil {
+				return false, false, err
+			}
+			fmt.Fprintf(d.out, "0x%03X: %04X    %s\n", inst.PC, inst.Opcode, inst.Mnemonic)
+		}
+		d.printRegisters()
+
+	case "back":
+		count := uint16(1)
+		if len(args) == 1 {
+			if count, err = parseAddr(args[0]); err != nil {
+				return false, false, err
+			}
+		}
+		for i := uint16(0); i < count; i++ {
+			if err := d.c.StepBackOne(); err != nil {
+				return false, false, err
+			}
+		}
+		d.printRegisters()
+
+	case "jump":
+		if len(args) != 1 {
+			return false, false, fmt.Errorf("usage: jump <addr>")
+		}
+		addr, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		if err := d.c.SetPC(addr); err != nil {
+			return false, false, err
+		}
+		d.printRegisters()
+
+	case "skip":
+		if d.c.Fault() == nil {
+			return false, false, fmt.Errorf("not stopped on an error")
+		}
+		d.c.SkipFault()
+		d.printRegisters()
+
+	case "break":
+		if len(args) != 1 {
+			return false, false, fmt.Errorf("usage: break <addr>")
+		}
+		addr, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		return false, false, d.c.BreakAt(addr)
+
+	case "breakop":
+		if len(args) != 2 {
+			return false, false, fmt.Errorf("usage: breakop <op> <mask>")
+		}
+		op, err := parseAddr(args[0])
+		if err != nil {
+			return false, false, err
+		}
+		mask, err := parseAddr(args[1])
+		if err != nil {
+			return false, false, err
+		}
+		d.c.BreakOnOpcode(op, mask)
+
+	case "clear":
+		d.c.ClearBreakpoints()
+
+	case "continue", "c":
+		d.c.Resume()
+		return true, true, nil
+
+	case "quit", "q":
+		return true, false, nil
+
+	default:
+		return false, false, fmt.Errorf("unknown command %q, try help", fields[0])
+	}
+	return false, false, nil
+}
+
+func (d *Debugger) printRegisters() {
+	c := d.c
+	for i, v := range c.V {
+		fmt.Fprintf(d.out, "V%X=%02X ", i, v)
+		if i%8 == 7 {
+			fmt.Fprintln(d.out)
+		}
+	}
+	fmt.Fprintf(d.out, "I=%03X PC=%03X SP=%X DT=%02X ST=%02X\n", c.I, c.pc, c.sp, c.delayTimer, c.soundTimer)
+}
+
+func (d *Debugger) printMemory(addr, count uint16) error {
+	for i := uint16(0); i < count; i++ {
+		b, err := d.c.Peek(addr + i)
+		if err != nil {
+			return err
+		}
+		if i%16 == 0 {
+			if i > 0 {
+				fmt.Fprintln(d.out)
+			}
+			fmt.Fprintf(d.out, "%03X:", addr+i)
+		}
+		fmt.Fprintf(d.out, " %02X", b)
+	}
+	fmt.Fprintln(d.out)
+	return nil
+}
+
+func parseAddr(s string) (uint16, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint16(n), nil
+}
+
+func parseByte(s string) (byte, error) {
+	n, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("invalid byte %q", s)
+	}
+	return byte(n), nil
+}
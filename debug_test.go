@@ -0,0 +1,331 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// peek reads a byte that's known to be in range.
+func peek(t *testing.T, c *Chip8, addr uint16) byte {
+	t.Helper()
+	b, err := c.Peek(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDebuggerPoke(t *testing.T) {
+	c := newTestChip8(t)
+	d := NewDebugger(c, &bytes.Buffer{})
+
+	if _, _, err := d.Exec("poke 0x300 ab"); err != nil {
+		t.Fatal(err)
+	}
+	if b := peek(t, c, 0x300); b != 0xAB {
+		t.Errorf("0x300 is 0x%02X after poke, want 0xAB", b)
+	}
+
+	for _, line := range []string{"poke 300", "poke 1000 1", "poke 300 100", "poke xyz 1"} {
+		if _, _, err := d.Exec(line); err == nil {
+			t.Errorf("%q: no error", line)
+		}
+	}
+	if b := peek(t, c, 0x300); b != 0xAB {
+		t.Errorf("0x300 is 0x%02X after bad pokes, want it left at 0xAB", b)
+	}
+}
+
+func TestDebuggerEdit(t *testing.T) {
+	c := newTestChip8(t)
+	var out bytes.Buffer
+	resume, err := NewDebugger(c, &out).Run(strings.NewReader("edit 310\n1 2 3\nff\n\npoke 320 7\ncontinue\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !resume {
+		t.Error("continue didn't resume")
+	}
+	for addr, want := range map[uint16]byte{0x310: 1, 0x311: 2, 0x312: 3, 0x313: 0xFF, 0x314: 0, 0x320: 7} {
+		if b := peek(t, c, addr); b != want {
+			t.Errorf("0x%03X is 0x%02X, want 0x%02X", addr, b, want)
+		}
+	}
+	if !strings.Contains(out.String(), "edit 0x313> ") {
+		t.Errorf("output %q doesn't prompt for the next address while editing", out.String())
+	}
+}
+
+func TestStackFrames(t *testing.T) {
+	c := newTestChip8(t,
+		0x22, 0x06, // 200: CALL 0x206
+		0x00, 0x00, 0x00, 0x00,
+		0x22, 0x0C, // 206: CALL 0x20C
+		0x00, 0x00, 0x00, 0x00,
+		0x22, 0x12, // 20C: CALL 0x212
+		0x00, 0x00, 0x00, 0x00,
+		0x12, 0x12, // 212: JP 0x212
+	)
+	step(t, c, 3)
+
+	want := []StackFrame{{Return: 0x202, Entry: 0x206}, {Return: 0x208, Entry: 0x20C}, {Return: 0x20E, Entry: 0x212}}
+	if got := c.StackFrames(); !reflect.DeepEqual(got, want) {
+		t.Errorf("StackFrames() = %+v, want %+v", got, want)
+	}
+	if got := c.Stack(); !reflect.DeepEqual(got, []uint16{0x202, 0x208, 0x20E}) {
+		t.Errorf("Stack() = %03X, want [202 208 20E]", got)
+	}
+}
+
+func TestBreakOnOpcode(t *testing.T) {
+	// LD V0, 1; LD V1, 2; DRW V0, V1, 1; JP 0x206
+	c := newTestChip8(t, 0x60, 0x01, 0x61, 0x02, 0xD0, 0x11, 0x12, 0x06)
+	c.BreakOnOpcode(0xD000, 0xF000)
+
+	for i := 0; i < 10 && !c.Paused; i++ {
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !c.Paused || c.pc != 0x204 {
+		t.Fatalf("paused %v at 0x%03X, want paused on the DXYN at 0x204", c.Paused, c.pc)
+	}
+	if len(setPixels(c)) != 0 {
+		t.Error("the sprite was drawn before the break")
+	}
+
+	c.Resume()
+	if err := c.cycle(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Paused || len(setPixels(c)) == 0 {
+		t.Errorf("paused %v with %d pixels set after resuming, want the sprite drawn", c.Paused, len(setPixels(c)))
+	}
+}
+
+func TestStep(t *testing.T) {
+	// LD V0, 0x12; DRW V3, V4, 5
+	c := newTestChip8(t, 0x60, 0x12, 0xD3, 0x45)
+	c.Paused = true
+	step(t, c, 1)
+	inst, err := c.Step()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Instruction{PC: 0x202, Opcode: 0xD345, Mnemonic: "DRW V[3], V[4], 0x5", X: 3, Y: 4, N: 5, NN: 0x45, NNN: 0x345}
+	if inst != want {
+		t.Errorf("got %+v, want %+v", inst, want)
+	}
+	if c.V[0] != 0x12 || c.pc != 0x204 || !c.Paused {
+		t.Errorf("V0=0x%02X pc=0x%03X paused %v, want both instructions run and still paused", c.V[0], c.pc, c.Paused)
+	}
+}
+
+func TestCurrentOpcode(t *testing.T) {
+	c := newTestChip8(t, 0x60, 0x01, 0xD0, 0x15)
+	step(t, c, 1)
+	before := c.SaveState()
+	if op := c.CurrentOpcode(); op != 0xD015 {
+		t.Errorf("CurrentOpcode() = 0x%04X, want 0xD015", op)
+	}
+	if !bytes.Equal(c.SaveState(), before) {
+		t.Error("CurrentOpcode changed the machine")
+	}
+
+	// pc can't normally get here, but the opcode is still read without going past the end
+	c.memory[0xFFF] = 0xAB
+	for _, tt := range []struct {
+		pc   uint16
+		want uint16
+	}{{0xFFE, 0x00AB}, {0xFFF, 0xAB00}, {0x1000, 0}} {
+		c.pc = tt.pc
+		if op := c.CurrentOpcode(); op != tt.want {
+			t.Errorf("CurrentOpcode() at 0x%03X = 0x%04X, want 0x%04X", tt.pc, op, tt.want)
+		}
+	}
+}
+
+func TestPauseFreezesTheMachine(t *testing.T) {
+	// ADD V0, 1; JP 0x200
+	c := newTestChip8(t, 0x70, 0x01, 0x12, 0x00)
+	c.delayTimer, c.soundTimer = 100, 100
+	c.Pause()
+	pc, v0 := c.pc, c.V[0]
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+		if err := c.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.pc != pc || c.V[0] != v0 || c.delayTimer != 100 || c.soundTimer != 100 {
+		t.Errorf("pc=0x%03X V0=%d timers %d and %d after pausing, want nothing changed",
+			c.pc, c.V[0], c.delayTimer, c.soundTimer)
+	}
+
+	c.Resume()
+	emulate(t, c, c.cyclesPerFrame())
+	if c.V[0] == v0 || c.delayTimer == 100 {
+		t.Errorf("V0=%d delay timer %d after resuming, want both moving again", c.V[0], c.delayTimer)
+	}
+}
+
+func TestPauseDuringKeyWait(t *testing.T) {
+	// LD V3, K; JP 0x202
+	c := newTestChip8(t, 0xF3, 0x0A, 0x12, 0x02)
+	keys := &fakeKeypad{}
+	c.Keypad = keys
+	c.ClockHz = 6000
+	emulate(t, c, 3)
+	if c.pc != 0x200 {
+		t.Fatalf("pc 0x%03X with no key pressed, want FX0A still waiting", c.pc)
+	}
+
+	// A key tapped while paused isn't seen, and the paused machine idles rather than spinning
+	c.Pause()
+	keys[7] = true
+	start := time.Now()
+	emulate(t, c, 3)
+	if elapsed := time.Since(start); elapsed < 3*time.Second/60*9/10 {
+		t.Errorf("3 paused cycles took %v, want them to idle for a frame each", elapsed)
+	}
+	keys[7] = false
+	c.Resume()
+	emulate(t, c, 3)
+	if c.pc != 0x200 {
+		t.Fatalf("pc 0x%03X after a key was tapped while paused, want FX0A still waiting", c.pc)
+	}
+
+	keys[7] = true
+	emulate(t, c, 3)
+	if c.pc != 0x202 || c.V[3] != 7 {
+		t.Errorf("pc 0x%03X with V3=%d after pressing 7, want the wait over with V3=7", c.pc, c.V[3])
+	}
+}
+
+func TestSetPC(t *testing.T) {
+	// LD V0, 1; LD V0, 2
+	c := newTestChip8(t, 0x60, 0x01, 0x60, 0x02)
+	if err := c.SetPC(0x202); err != nil {
+		t.Fatal(err)
+	}
+	if c.PC() != 0x202 || c.CurrentOpcode() != 0x6002 {
+		t.Fatalf("pc 0x%03X with opcode 0x%04X next, want 0x202 and 0x6002", c.PC(), c.CurrentOpcode())
+	}
+	step(t, c, 1)
+	if c.V[0] != 2 {
+		t.Errorf("V0 = %d, want the instruction at 0x202 run", c.V[0])
+	}
+
+	for _, addr := range []uint16{0x1000, 0xFFF, 0xFFFF, 0x203} {
+		if err := c.SetPC(addr); err == nil {
+			t.Errorf("SetPC(0x%X) didn't fail", addr)
+		}
+	}
+	if c.PC() != 0x204 {
+		t.Errorf("pc 0x%03X after the bad SetPC calls, want it left at 0x204", c.PC())
+	}
+}
+
+func TestPauseOnError(t *testing.T) {
+	// LD V0, 1; an unknown opcode; LD V1, 1
+	c := newTestChip8(t, 0x60, 0x01, 0xFF, 0xFF, 0x61, 0x01)
+	c.PauseOnError = true
+	for i := 0; i < 2; i++ {
+		if err := c.cycle(); err != nil {
+			t.Fatalf("cycle %d returned %v, want the machine paused instead", i+1, err)
+		}
+	}
+
+	var unknown unknownOpcodeError
+	if !c.Paused || c.pc != 0x202 || !errors.As(c.Fault(), &unknown) {
+		t.Fatalf("paused %v at 0x%03X with fault %v, want paused on the unknown opcode at 0x202", c.Paused, c.pc, c.Fault())
+	}
+	var out bytes.Buffer
+	if _, err := NewDebugger(c, &out).Run(strings.NewReader("skip\ncontinue\n")); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "stopped on error at 0x202: unknown opcode: 0xFFFF") {
+		t.Errorf("debugger said %q, want the error shown", out.String())
+	}
+
+	c.Resume()
+	if err := c.cycle(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Fault() != nil || c.V[1] != 1 {
+		t.Errorf("fault %v with V1=%d after skipping, want it cleared and the next instruction run", c.Fault(), c.V[1])
+	}
+}
+
+func TestAccessorsOutOfRange(t *testing.T) {
+	c := newTestChip8(t, 0x12, 0x00)
+	before := c.SaveState()
+
+	for _, x := range []int{-1, 16, 255} {
+		if _, err := c.Register(x); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Register(%d): error %v, want out of range", x, err)
+		}
+		if err := c.SetRegister(x, 1); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("SetRegister(%d): error %v, want out of range", x, err)
+		}
+	}
+	for _, addr := range []uint16{0x1000, 0xFFFF} {
+		if _, err := c.Peek(addr); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Peek(0x%X): error %v, want out of range", addr, err)
+		}
+		if err := c.Poke(addr, 1); err == nil || !strings.Contains(err.Error(), "out of range") {
+			t.Errorf("Poke(0x%X): error %v, want out of range", addr, err)
+		}
+	}
+	if !bytes.Equal(c.SaveState(), before) {
+		t.Error("a failed access changed the machine")
+	}
+
+	// The last register and byte of memory are in range
+	if err := c.SetRegister(15, 1); err != nil {
+		t.Error(err)
+	}
+	if err := c.Poke(0xFFF, 1); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadMemory(t *testing.T) {
+	// LD V3, 0x33; LD I, 0xFFC; LD [I], V3; LD DT, V3
+	c := newTestChip8(t, 0x63, 0x33, 0xAF, 0xFC, 0xF3, 0x55, 0xF3, 0x15)
+	step(t, c, 4)
+
+	got, err := c.ReadMemory(0x200, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x63, 0x33, 0xAF, 0xFC}; !bytes.Equal(got, want) {
+		t.Errorf("ReadMemory(0x200, 4) = % X, want % X", got, want)
+	}
+	got[0] = 0
+	if c.memory[0x200] != 0x63 {
+		t.Error("changing the bytes read changed memory")
+	}
+	if got, err := c.ReadMemory(0xFFC, 4); err != nil || !bytes.Equal(got, []byte{0, 0, 0, 0x33}) {
+		t.Errorf("ReadMemory(0xFFC, 4) = % X, %v, want the last 4 bytes with V3 stored", got, err)
+	}
+
+	for _, tt := range []struct {
+		addr uint16
+		n    int
+	}{{0xFFD, 4}, {0x1000, 1}, {0x200, -1}} {
+		if _, err := c.ReadMemory(tt.addr, tt.n); err == nil {
+			t.Errorf("ReadMemory(0x%X, %d) succeeded, want out of range", tt.addr, tt.n)
+		}
+	}
+
+	if regs := c.RegisterDump(); regs[3] != 0x33 || regs != c.V {
+		t.Errorf("RegisterDump() = % X, want V3 0x33", regs)
+	}
+	if c.PC() != 0x208 || c.SP() != 0 || c.DelayTimer() != 0x33 || c.SoundTimer() != 0 {
+		t.Errorf("PC=0x%03X SP=%d DT=%d ST=%d, want 0x208, 0, 51 and 0", c.PC(), c.SP(), c.DelayTimer(), c.SoundTimer())
+	}
+}
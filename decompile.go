@@ -0,0 +1,192 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// flowGraph is the control flow found by following the code in a ROM from its entry point.
+type flowGraph struct {
+	rom []byte
+	// owner is the entry point of the routine each reachable instruction was found in, 0x200
+	// for the main program
+	owner map[int]int
+	// leaders are the addresses that start a basic block
+	leaders map[int]bool
+	subs    map[int]bool
+	jumps   map[int]bool
+	// loops are jump targets reached by jumping backwards, and backEdges the jumps that do it
+	loops     map[int]bool
+	backEdges map[int]bool
+}
+
+// opcodeAt returns the instruction at addr, or false if it isn't entirely inside the ROM.
+func (g *flowGraph) opcodeAt(addr int) (uint16, bool) {
+	i := addr - 0x200
+	if i < 0 || i+1 >= len(g.rom) {
+		return 0, false
+	}
+	return uint16(g.rom[i])<<8 | uint16(g.rom[i+1]), true
+}
+
+// isSkip reports whether opcode conditionally skips the next instruction.
+func isSkip(opcode uint16) bool {
+	switch opcode & 0xF000 {
+	case 0x3000, 0x4000:
+		return true
+	case 0x5000, 0x9000:
+		return opcode&0x000F == 0
+	case 0xE000:
+		return opcode&0x00FF == 0x9E || opcode&0x00FF == 0xA1
+	}
+	return false
+}
+
+// successors returns where execution can go after the instruction at addr, not counting the
+// subroutine a call goes into.
+func successors(addr int, opcode uint16) []int {
+	switch {
+	case opcode == 0x00EE, opcode == 0x00FD, opcode&0xF000 == 0xB000:
+		// Exiting goes nowhere, and the return address and computed jumps can't be known
+		// without running the program
+		return nil
+	case opcode&0xF000 == 0x1000:
+		return []int{int(opcode & 0x0FFF)}
+	case isSkip(opcode):
+		return []int{addr + 2, addr + 4}
+	}
+	return []int{addr + 2}
+}
+
+// analyzeFlow follows every path through the main program and the subroutines it calls.
+func analyzeFlow(rom []byte) *flowGraph {
+	g := &flowGraph{
+		rom:       rom,
+		owner:     make(map[int]int),
+		leaders:   map[int]bool{0x200: true},
+		subs:      make(map[int]bool),
+		jumps:     make(map[int]bool),
+		loops:     make(map[int]bool),
+		backEdges: make(map[int]bool),
+	}
+
+	routines := []int{0x200}
+	for len(routines) > 0 {
+		entry := routines[0]
+		routines = routines[1:]
+
+		pending := []int{entry}
+		for len(pending) > 0 {
+			addr := pending[len(pending)-1]
+			pending = pending[:len(pending)-1]
+			if _, seen := g.owner[addr]; seen {
+				continue
+			}
+			opcode, ok := g.opcodeAt(addr)
+			if !ok {
+				continue
+			}
+			g.owner[addr] = entry
+
+			if opcode&0xF000 == 0x2000 {
+				target := int(opcode & 0x0FFF)
+				if !g.subs[target] {
+					g.subs[target] = true
+					g.leaders[target] = true
+					routines = append(routines, target)
+				}
+			}
+
+			next := successors(addr, opcode)
+			if opcode&0xF000 == 0x1000 {
+				target := next[0]
+				g.jumps[target] = true
+				if target <= addr {
+					g.loops[target] = true
+					g.backEdges[addr] = true
+				}
+			}
+			// Anything other than carrying straight on ends the block
+			if len(next) != 1 || next[0] != addr+2 {
+				for _, n := range next {
+					g.leaders[n] = true
+				}
+				g.leaders[addr+2] = true
+			}
+			pending = append(pending, next...)
+		}
+	}
+	return g
+}
+
+// label returns the name given to addr, or "" if it doesn't have one.
+func (g *flowGraph) label(addr int) string {
+	switch {
+	case addr == 0x200:
+		return "main"
+	case g.subs[addr]:
+		return fmt.Sprintf("sub_%03X", addr)
+	case g.loops[addr]:
+		return fmt.Sprintf("loop_%03X", addr)
+	case g.jumps[addr]:
+		return fmt.Sprintf("label_%03X", addr)
+	}
+	return ""
+}
+
+// asm returns the assembly for opcode, with jump and call targets replaced by their labels.
+func (g *flowGraph) asm(opcode uint16) string {
+	if name := g.label(int(opcode & 0x0FFF)); name != "" {
+		switch opcode & 0xF000 {
+		case 0x1000:
+			return "JP " + name
+		case 0x2000:
+			return "CALL " + name
+		}
+	}
+	asm, _ := Mnemonic(opcode)
+	return asm
+}
+
+// Decompile follows the code in rom from 0x200 and returns it as labelled assembly, split into
+// basic blocks by blank lines. The main program is labelled main, subroutines sub_XXX,
+// the targets of backward jumps loop_XXX and other jump targets label_XXX. Subroutine code is
+// indented a level further than the main program. Bytes that are never reached as code, such
+// as sprites, are shown as DB.
+func Decompile(rom []byte) string {
+	g := analyzeFlow(rom)
+
+	var b strings.Builder
+	for addr := 0x200; addr < 0x200+len(rom); {
+		owner, isCode := g.owner[addr]
+		if !isCode {
+			fmt.Fprintf(&b, "\t0x%03X: DB 0x%02X\n", addr, rom[addr-0x200])
+			addr++
+			continue
+		}
+
+		if g.leaders[addr] && addr != 0x200 {
+			b.WriteString("\n")
+		}
+		if name := g.label(addr); name != "" {
+			fmt.Fprintf(&b, "%s:\n", name)
+		}
+
+		indent := "\t"
+		if owner != 0x200 {
+			indent = "\t\t"
+		}
+		opcode, _ := g.opcodeAt(addr)
+		fmt.Fprintf(&b, "%s0x%03X: %s", indent, addr, g.asm(opcode))
+		if g.backEdges[addr] {
+			if int(opcode&0x0FFF) == addr {
+				b.WriteString("    ; halt")
+			} else {
+				b.WriteString("    ; loop")
+			}
+		}
+		b.WriteString("\n")
+		addr += 2
+	}
+	return b.String()
+}
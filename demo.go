@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"os"
+)
+
+// Demo is a recording of a run: the random seed, the keys held down during each frame and a
+// hash of the display at the end of each frame. Replaying the same ROM with the demo's keys
+// should reproduce every frame exactly, which makes recorded gameplay usable as a
+// regression test.
+type Demo struct {
+	Seed int64 `json:"seed"`
+	// Keys is the keypad state for each frame. Frames past the end have no keys down.
+	Keys   [][16]bool `json:"keys"`
+	Hashes []uint64   `json:"hashes"`
+}
+
+// replayState tracks a demo being checked against the running machine.
+type replayState struct {
+	demo *Demo
+	err  error
+}
+
+// FramebufferHash returns a hash of the display contents and resolution.
+func (c *Chip8) FramebufferHash() uint64 {
+	h := fnv.New64a()
+	if c.hires {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+	h.Write(c.SaveFramebuffer())
+	return h.Sum64()
+}
+
+// StartRecording begins recording a demo. It should be called after loading the ROM and before
+// running anything. While recording, the keys are only read at the start of each frame, so
+// that replaying them once per frame behaves the same.
+func (c *Chip8) StartRecording(seed int64) {
+	c.Rand = rand.New(rand.NewSource(seed))
+	c.recording = &Demo{Seed: seed}
+}
+
+// StopRecording ends the recording and returns the demo.
+func (c *Chip8) StopRecording() *Demo {
+	demo := c.recording
+	c.recording = nil
+	return demo
+}
+
+// Replay runs the loaded ROM headlessly with the keys from demo, comparing the display at the
+// end of every recorded frame with the demo's hashes. It stops at the first frame that
+// differs, returning an error naming it, and returns nil if every frame matched.
+func (c *Chip8) Replay(demo *Demo) error {
+	c.Rand = rand.New(rand.NewSource(demo.Seed))
+	c.replay = &replayState{demo: demo}
+	defer func() { c.replay = nil }()
+
+	frames := len(demo.Hashes)
+	for c.cycles < frames*c.cyclesPerFrame() {
+		if err := c.cycle(); err != nil {
+			return fmt.Errorf("frame %d: %v", c.cycles/c.cyclesPerFrame(), err)
+		}
+		if c.replay.err != nil {
+			return c.replay.err
+		}
+		if c.Paused {
+			return fmt.Errorf("frame %d: paused at a breakpoint", c.cycles/c.cyclesPerFrame())
+		}
+		c.pollKeys()
+	}
+	return nil
+}
+
+// pollKeys reads the keypad after a cycle, asking for the on-screen keypad to be redrawn when
+// the keys held down change.
+func (c *Chip8) pollKeys() {
+	c.prevKeys = c.keys
+	c.keys = c.nextKeys()
+	if c.ShowKeypad && c.keys != c.prevKeys {
+		c.drawFlag = true
+	}
+}
+
+// nextKeys returns the keys held down for the next cycle. While recording or replaying a demo
+// the keys only change at the start of each frame.
+func (c *Chip8) nextKeys() [16]bool {
+	if c.recording == nil && c.replay == nil {
+		return c.getKeyState()
+	}
+	if c.cycles%c.cyclesPerFrame() != 0 {
+		return c.keys
+	}
+
+	frame := c.cycles / c.cyclesPerFrame()
+	if c.replay != nil {
+		if frame < len(c.replay.demo.Keys) {
+			return c.replay.demo.Keys[frame]
+		}
+		return [16]bool{}
+	}
+
+	keys := c.getKeyState()
+	for len(c.recording.Keys) <= frame {
+		c.recording.Keys = append(c.recording.Keys, [16]bool{})
+	}
+	c.recording.Keys[frame] = keys
+	return keys
+}
+
+// checkDemoFrame records or checks the hash of the frame that just ended.
+func (c *Chip8) checkDemoFrame() {
+	frame := c.cycles/c.cyclesPerFrame() - 1
+
+	if c.recording != nil {
+		c.recording.Hashes = append(c.recording.Hashes, c.FramebufferHash())
+	}
+
+	if c.replay != nil && c.replay.err == nil && frame < len(c.replay.demo.Hashes) {
+		if got, want := c.FramebufferHash(), c.replay.demo.Hashes[frame]; got != want {
+			c.replay.err = fmt.Errorf("frame %d: display hash is %016x, the demo has %016x", frame, got, want)
+		}
+	}
+}
+
+// LoadDemo reads a demo saved with SaveDemo.
+func LoadDemo(path string) (*Demo, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	demo := &Demo{}
+	if err := json.Unmarshal(data, demo); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return demo, nil
+}
+
+// SaveDemo writes demo to the file at path.
+func SaveDemo(path string, demo *Demo) error {
+	data, err := json.Marshal(demo)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
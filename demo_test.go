@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// demoROM draws the digit 0 at random places, but only while key 5 is held down.
+var demoROM = []byte{
+	0xC0, 0x3F, // 200: RND V0, 0x3F
+	0xC1, 0x1F, // 202: RND V1, 0x1F
+	0x65, 0x05, // 204: LD V5, 5
+	0xE5, 0x9E, // 206: SKP V5
+	0x12, 0x00, // 208: JP 0x200
+	0xD0, 0x15, // 20A: DRW V0, V1, 5
+	0x12, 0x00, // 20C: JP 0x200
+}
+
+// recordDemo runs demoROM for frames frames, holding key 5 down for every third frame.
+func recordDemo(t *testing.T, frames int) *Demo {
+	t.Helper()
+	c := newTestChip8(t, demoROM...)
+	keys := &fakeKeypad{}
+	c.Keypad = keys
+	c.StartRecording(42)
+	for c.cycles < frames*c.cyclesPerFrame() {
+		keys[5] = c.cycles/c.cyclesPerFrame()%3 == 0
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+		c.pollKeys()
+	}
+	return c.StopRecording()
+}
+
+func TestReplay(t *testing.T) {
+	demo := recordDemo(t, 20)
+	if len(demo.Hashes) != 20 {
+		t.Fatalf("recorded %d frame hashes, want 20", len(demo.Hashes))
+	}
+	if err := newTestChip8(t, demoROM...).Replay(demo); err != nil {
+		t.Errorf("replay diverged: %v", err)
+	}
+
+	demo.Hashes[7] ^= 1
+	err := newTestChip8(t, demoROM...).Replay(demo)
+	if err == nil || !strings.HasPrefix(err.Error(), "frame 7:") {
+		t.Errorf("replay with frame 7 corrupted: error %v, want a divergence at frame 7", err)
+	}
+}
+
+func TestReplayNeedsTheKeys(t *testing.T) {
+	demo := recordDemo(t, 20)
+	demo.Keys = nil
+	if err := newTestChip8(t, demoROM...).Replay(demo); err == nil {
+		t.Error("replay without the recorded keys didn't diverge")
+	}
+}
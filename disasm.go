@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// Mnemonic returns the assembly for a single opcode, using the register and operand notation
+// from the comments on the opcode handlers. ok is false if it isn't a known instruction.
+func Mnemonic(opcode uint16) (asm string, ok bool) {
+	x := (opcode & 0x0F00) >> 8
+	y := (opcode & 0x00F0) >> 4
+	n := opcode & 0x000F
+	nn := opcode & 0x00FF
+	nnn := opcode & 0x0FFF
+
+	switch opcode & 0xF000 {
+	case 0x0000:
+		if opcode&0xFFF0 == 0x00C0 {
+			return fmt.Sprintf("SCD 0x%X", n), true
+		}
+		switch opcode {
+		case 0x00E0:
+			return "CLS", true
+		case 0x00EE:
+			return "RET", true
+		case 0x00FB:
+			return "SCR", true
+		case 0x00FC:
+			return "SCL", true
+		case 0x00FD:
+			return "EXIT", true
+		case 0x00FE:
+			return "LOW", true
+		case 0x00FF:
+			return "HIGH", true
+		}
+	case 0x1000:
+		return fmt.Sprintf("JP 0x%03X", nnn), true
+	case 0x2000:
+		return fmt.Sprintf("CALL 0x%03X", nnn), true
+	case 0x3000:
+		return fmt.Sprintf("SE V[%X], 0x%02X", x, nn), true
+	case 0x4000:
+		return fmt.Sprintf("SNE V[%X], 0x%02X", x, nn), true
+	case 0x5000:
+		if n == 0 {
+			return fmt.Sprintf("SE V[%X], V[%X]", x, y), true
+		}
+	case 0x6000:
+		return fmt.Sprintf("LD V[%X], 0x%02X", x, nn), true
+	case 0x7000:
+		return fmt.Sprintf("ADD V[%X], 0x%02X", x, nn), true
+	case 0x8000:
+		ops := map[uint16]string{
+			0x0: "LD", 0x1: "OR", 0x2: "AND", 0x3: "XOR", 0x4: "ADD",
+			0x5: "SUB", 0x6: "SHR", 0x7: "SUBN", 0xE: "SHL",
+		}
+		if op, ok := ops[n]; ok {
+			return fmt.Sprintf("%s V[%X], V[%X]", op, x, y), true
+		}
+	case 0x9000:
+		if n == 0 {
+			return fmt.Sprintf("SNE V[%X], V[%X]", x, y), true
+		}
+	case 0xA000:
+		return fmt.Sprintf("LD I, 0x%03X", nnn), true
+	case 0xB000:
+		return fmt.Sprintf("JP V[0], 0x%03X", nnn), true
+	case 0xC000:
+		return fmt.Sprintf("RND V[%X], 0x%02X", x, nn), true
+	case 0xD000:
+		return fmt.Sprintf("DRW V[%X], V[%X], 0x%X", x, y, n), true
+	case 0xE000:
+		switch nn {
+		case 0x9E:
+			return fmt.Sprintf("SKP V[%X]", x), true
+		case 0xA1:
+			return fmt.Sprintf("SKNP V[%X]", x), true
+		}
+	case 0xF000:
+		formats := map[uint16]string{
+			0x07: "LD V[%X], DT",
+			0x0A: "LD V[%X], K",
+			0x15: "LD DT, V[%X]",
+			0x18: "LD ST, V[%X]",
+			0x1E: "ADD I, V[%X]",
+			0x29: "LD F, V[%X]",
+			0x30: "LD HF, V[%X]",
+			0x33: "LD B, V[%X]",
+			0x55: "LD [I], V[%X]",
+			0x65: "LD V[%X], [I]",
+			0x75: "LD R, V[%X]",
+			0x85: "LD V[%X], R",
+		}
+		if format, ok := formats[nn]; ok {
+			return fmt.Sprintf(format, x), true
+		}
+	}
+	return fmt.Sprintf("DW 0x%04X", opcode), false
+}
+
+// Disassemble walks rom two bytes at a time, as it would be laid out from 0x200, and returns
+// a line for each opcode like:
+//
+//	0x200: 6A02    LD V[A], 0x02
+//
+// Anything that isn't a known instruction, including sprite data, comes out as DW. A trailing
+// odd byte is shown on its own as DB.
+func Disassemble(rom []byte) []string {
+	lines := make([]string, 0, len(rom)/2+1)
+	for i := 0; i < len(rom); i += 2 {
+		addr := 0x200 + i
+		if i+1 == len(rom) {
+			lines = append(lines, fmt.Sprintf("0x%03X: %02X      DB 0x%02X", addr, rom[i], rom[i]))
+			break
+		}
+		opcode := uint16(rom[i])<<8 | uint16(rom[i+1])
+		asm, _ := Mnemonic(opcode)
+		lines = append(lines, fmt.Sprintf("0x%03X: %04X    %s", addr, opcode, asm))
+	}
+	return lines
+}
+
+// WriteDisassembly writes the disassembly of rom to w, annotated with a comment above each
+// address that is the target of a jump or call.
+func WriteDisassembly(w io.Writer, rom []byte) error {
+	calls := make(map[int]bool)
+	jumps := make(map[int]bool)
+	for i := 0; i+1 < len(rom); i += 2 {
+		opcode := uint16(rom[i])<<8 | uint16(rom[i+1])
+		switch opcode & 0xF000 {
+		case 0x1000:
+			jumps[int(opcode&0x0FFF)] = true
+		case 0x2000:
+			calls[int(opcode&0x0FFF)] = true
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	for i, line := range Disassemble(rom) {
+		addr := 0x200 + i*2
+		if calls[addr] {
+			fmt.Fprintf(bw, "\n; subroutine 0x%03X\n", addr)
+		} else if jumps[addr] {
+			fmt.Fprintf(bw, "; jump target 0x%03X\n", addr)
+		}
+		fmt.Fprintln(bw, line)
+	}
+	return bw.Flush()
+}
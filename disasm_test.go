@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// disasmROM calls a subroutine and loops, with a byte of data on the end.
+var disasmROM = []byte{
+	0x22, 0x06, // 200: CALL 0x206
+	0x6A, 0x02, // 202: LD VA, 2
+	0x12, 0x02, // 204: JP 0x202
+	0xD0, 0x15, // 206: DRW V0, V1, 5
+	0x00, 0xEE, // 208: RET
+	0xFF,
+}
+
+const disasmListing = `0x200: 2206    CALL 0x206
+; jump target 0x202
+0x202: 6A02    LD V[A], 0x02
+0x204: 1202    JP 0x202
+
+; subroutine 0x206
+0x206: D015    DRW V[0], V[1], 0x5
+0x208: 00EE    RET
+0x20A: FF      DB 0xFF
+`
+
+func TestDisassemble(t *testing.T) {
+	rom := append(append([]byte(nil), disasmROM[:10]...), 0x50, 0x01, 0xFF)
+	want := []string{
+		"0x200: 2206    CALL 0x206",
+		"0x202: 6A02    LD V[A], 0x02",
+		"0x204: 1202    JP 0x202",
+		"0x206: D015    DRW V[0], V[1], 0x5",
+		"0x208: 00EE    RET",
+		"0x20A: 5001    DW 0x5001",
+		"0x20C: FF      DB 0xFF",
+	}
+	if got := Disassemble(rom); !reflect.DeepEqual(got, want) {
+		t.Errorf("got\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteDisassembly(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteDisassembly(&buf, disasmROM); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != disasmListing {
+		t.Errorf("disassembly:\n%s\nwant:\n%s", buf.String(), disasmListing)
+	}
+}
+
+func TestWriteDisassemblyFile(t *testing.T) {
+	dir := t.TempDir()
+	rom, out := filepath.Join(dir, "game.ch8"), filepath.Join(dir, "game.asm")
+	if err := os.WriteFile(rom, withOctoMetadata(disasmROM, `{"tickrate":20}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDisassembly(rom, out); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != disasmListing {
+		t.Errorf("disassembly written to the file, without the metadata:\n%s\nwant:\n%s", got, disasmListing)
+	}
+}
+
+func TestDecompile(t *testing.T) {
+	want := "main:\n" +
+		"\t0x200: CALL sub_206\n" +
+		"\n" +
+		"loop_202:\n" +
+		"\t0x202: LD V[A], 0x02\n" +
+		"\t0x204: JP loop_202    ; loop\n" +
+		"\n" +
+		"sub_206:\n" +
+		"\t\t0x206: DRW V[0], V[1], 0x5\n" +
+		"\t\t0x208: RET\n" +
+		"\t0x20A: DB 0xFF\n"
+	if got := Decompile(disasmROM); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import "encoding/binary"
+
+// Features lists the extensions to CHIP-8 that a ROM uses.
+type Features struct {
+	// SCHIP and XOCHIP are set if any opcode from that platform is used
+	SCHIP  bool
+	XOCHIP bool
+
+	// HiRes is the 128x64 mode, 00FE/00FF
+	HiRes bool
+	// Scroll is any of the scrolling opcodes, 00CN/00DN/00FB/00FC, and ScrollUp is XO-CHIP's
+	// 00DN on its own
+	Scroll   bool
+	ScrollUp bool
+	// Planes is XO-CHIP's second display plane, FN01
+	Planes bool
+	// LongIndex is XO-CHIP's F000 NNNN, which loads a 16 bit address into I
+	LongIndex bool
+	// ExtendedAudio is XO-CHIP's pattern playback, F002 and FX3A
+	ExtendedAudio bool
+}
+
+// RequiredFeatures scans rom for SCHIP and XO-CHIP opcodes to work out which extensions it
+// needs. Every aligned pair of bytes is treated as an instruction, so data that happens to
+// look like an extended opcode will be counted too.
+func RequiredFeatures(rom []byte) Features {
+	var f Features
+	for i := 0; i+1 < len(rom); i += 2 {
+		opcode := binary.BigEndian.Uint16(rom[i:])
+
+		switch {
+		case opcode == 0x00FE || opcode == 0x00FF:
+			f.SCHIP, f.HiRes = true, true
+		case opcode&0xFFF0 == 0x00C0 || opcode == 0x00FB || opcode == 0x00FC:
+			f.SCHIP, f.Scroll = true, true
+		case opcode == 0x00FD:
+			f.SCHIP = true
+		case opcode&0xF00F == 0xD000:
+			f.SCHIP = true
+		case opcode&0xF0FF == 0xF030 || opcode&0xF0FF == 0xF075 || opcode&0xF0FF == 0xF085:
+			f.SCHIP = true
+
+		case opcode&0xFFF0 == 0x00D0:
+			f.XOCHIP, f.Scroll, f.ScrollUp = true, true, true
+		case opcode&0xF00F == 0x5002 || opcode&0xF00F == 0x5003:
+			f.XOCHIP = true
+		case opcode == 0xF000:
+			f.XOCHIP, f.LongIndex = true, true
+			// The address takes up the next two bytes
+			i += 2
+		case opcode&0xF0FF == 0xF001:
+			f.XOCHIP, f.Planes = true, true
+		case opcode == 0xF002 || opcode&0xF0FF == 0xF03A:
+			f.XOCHIP, f.ExtendedAudio = true, true
+		}
+	}
+	return f
+}
+
+// Unsupported returns the names of the features in f that this emulator can't run.
+func (f Features) Unsupported() []string {
+	var names []string
+	if f.ScrollUp {
+		names = append(names, "scrolling up")
+	}
+	if f.Planes {
+		names = append(names, "display planes")
+	}
+	if f.LongIndex {
+		names = append(names, "16 bit addresses")
+	}
+	if f.ExtendedAudio {
+		names = append(names, "extended audio")
+	}
+	return names
+}
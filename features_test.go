@@ -0,0 +1,30 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRequiredFeatures(t *testing.T) {
+	tests := []struct {
+		name string
+		rom  []byte
+		want Features
+	}{
+		{"plain", []byte{0x60, 0x01, 0xD0, 0x15, 0x12, 0x04}, Features{}},
+		// LD I, 0x00FF (the address looks like 00FF, but isn't an instruction); JP 0x204
+		{"long index", []byte{0xF0, 0x00, 0x00, 0xFF, 0x12, 0x04}, Features{XOCHIP: true, LongIndex: true}},
+		{"hi-res", []byte{0x00, 0xFF, 0x12, 0x02}, Features{SCHIP: true, HiRes: true}},
+		{"scroll", []byte{0x00, 0xC4, 0x00, 0xFB}, Features{SCHIP: true, Scroll: true}},
+	}
+	for _, tt := range tests {
+		if got := RequiredFeatures(tt.rom); got != tt.want {
+			t.Errorf("%s: %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+
+	f := RequiredFeatures([]byte{0xF0, 0x00, 0x12, 0x34})
+	if want := []string{"16 bit addresses"}; !reflect.DeepEqual(f.Unsupported(), want) {
+		t.Errorf("unsupported %q for F000, want %q", f.Unsupported(), want)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFontVariants(t *testing.T) {
+	// The digits whose shapes differ between the fonts, so a wrong table shows up
+	type glyphs struct{ one, four, seven, b, d []byte }
+	chip8 := glyphs{
+		one:   []byte{0x20, 0x60, 0x20, 0x20, 0x70},
+		four:  []byte{0x90, 0x90, 0xF0, 0x10, 0x10},
+		seven: []byte{0xF0, 0x10, 0x20, 0x40, 0x40},
+		b:     []byte{0xE0, 0x90, 0xE0, 0x90, 0xE0},
+		d:     []byte{0xE0, 0x90, 0x90, 0x90, 0xE0},
+	}
+	vip := glyphs{
+		one:   []byte{0x60, 0x20, 0x20, 0x20, 0x70},
+		four:  []byte{0xA0, 0xA0, 0xF0, 0x20, 0x20},
+		seven: []byte{0xF0, 0x10, 0x10, 0x10, 0x10},
+		b:     []byte{0xF0, 0x50, 0x70, 0x50, 0xF0},
+		d:     []byte{0xF0, 0x50, 0x50, 0x50, 0xF0},
+	}
+	octo := vip
+	octo.one = chip8.one
+
+	tests := []struct {
+		name    string
+		fontset func() [80]byte
+		want    glyphs
+	}{
+		{"chip8", func() [80]byte { return Chip8Fontset }, chip8},
+		{"schip", FontSCHIP.Fontset, chip8},
+		{"vip", FontVIP.Fontset, vip},
+		{"octo", FontOcto.Fontset, octo},
+	}
+	for _, tt := range tests {
+		fontset := tt.fontset()
+		for _, g := range []struct {
+			digit int
+			want  []byte
+		}{{0x1, tt.want.one}, {0x4, tt.want.four}, {0x7, tt.want.seven}, {0xB, tt.want.b}, {0xD, tt.want.d}} {
+			if got := fontset[g.digit*5 : g.digit*5+5]; !bytes.Equal(got, g.want) {
+				t.Errorf("%s font: %X is % X, want % X", tt.name, g.digit, got, g.want)
+			}
+		}
+	}
+}
+
+func TestFontLoaded(t *testing.T) {
+	for _, font := range []Font{FontSCHIP, FontVIP, FontOcto} {
+		c := newTestChip8(t)
+		c.Font = font
+		c.Initialize()
+		// LD V0, 0xB; LD F, V0
+		if err := c.LoadGameBytes([]byte{0x60, 0x0B, 0xF0, 0x29}); err != nil {
+			t.Fatal(err)
+		}
+		step(t, c, 2)
+
+		got, err := c.ReadMemory(c.I, 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fontset := font.Fontset()
+		if want := fontset[0xB*5 : 0xB*5+5]; !bytes.Equal(got, want) {
+			t.Errorf("font %v: B is % X in memory, want % X", font, got, want)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// These benchmarks weigh up moving gfx and memory from fixed size arrays to slices. The two
+// machines below hold just those, and run the DXYN drawing loop and the opcode fetch the same
+// way Chip8 does, one with arrays, as Chip8 has now, and one with slices.
+
+type arrayFramebuffer struct {
+	memory [4096]byte
+	gfx    [hiResWidth * hiResHeight]byte
+}
+
+type sliceFramebuffer struct {
+	memory []byte
+	gfx    []byte
+}
+
+func newSliceFramebuffer() *sliceFramebuffer {
+	return &sliceFramebuffer{memory: make([]byte, 4096), gfx: make([]byte, hiResWidth*hiResHeight)}
+}
+
+func (m *arrayFramebuffer) draw(x, y, i, height uint16) (collision bool) {
+	for yline := uint16(0); yline < height; yline++ {
+		py := (y + yline) % hiResHeight
+		pixel := m.memory[i+yline]
+		for xline := uint16(0); xline < 8; xline++ {
+			if pixel&(0x80>>xline) != 0 {
+				idx := (x+xline)%hiResWidth + py*hiResWidth
+				if m.gfx[idx] == 1 {
+					collision = true
+				}
+				m.gfx[idx] ^= 1
+			}
+		}
+	}
+	return collision
+}
+
+func (m *sliceFramebuffer) draw(x, y, i, height uint16) (collision bool) {
+	for yline := uint16(0); yline < height; yline++ {
+		py := (y + yline) % hiResHeight
+		pixel := m.memory[i+yline]
+		for xline := uint16(0); xline < 8; xline++ {
+			if pixel&(0x80>>xline) != 0 {
+				idx := (x+xline)%hiResWidth + py*hiResWidth
+				if m.gfx[idx] == 1 {
+					collision = true
+				}
+				m.gfx[idx] ^= 1
+			}
+		}
+	}
+	return collision
+}
+
+func (m *arrayFramebuffer) fetch(pc uint16) uint16 {
+	return binary.BigEndian.Uint16([]byte{m.memory[pc], m.memory[pc+1]})
+}
+
+func (m *sliceFramebuffer) fetch(pc uint16) uint16 {
+	return binary.BigEndian.Uint16([]byte{m.memory[pc], m.memory[pc+1]})
+}
+
+// The draw workload is a screen full of solid 15 row sprites, drawn over and over so pixels
+// are set and then cleared again with a collision.
+const drawSpriteHeight = 15
+
+func fillSprite(memory []byte) {
+	for i := 0; i < drawSpriteHeight; i++ {
+		memory[0x300+i] = 0xFF
+	}
+}
+
+func BenchmarkFramebufferDraw(b *testing.B) {
+	b.Run("array", func(b *testing.B) {
+		m := &arrayFramebuffer{}
+		fillSprite(m.memory[:])
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for y := uint16(0); y < hiResHeight; y += drawSpriteHeight {
+				for x := uint16(0); x < hiResWidth; x += 8 {
+					m.draw(x, y, 0x300, drawSpriteHeight)
+				}
+			}
+		}
+	})
+	b.Run("slice", func(b *testing.B) {
+		m := newSliceFramebuffer()
+		fillSprite(m.memory)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for y := uint16(0); y < hiResHeight; y += drawSpriteHeight {
+				for x := uint16(0); x < hiResWidth; x += 8 {
+					m.draw(x, y, 0x300, drawSpriteHeight)
+				}
+			}
+		}
+	})
+}
+
+func BenchmarkFramebufferFetch(b *testing.B) {
+	b.Run("array", func(b *testing.B) {
+		m := &arrayFramebuffer{}
+		b.ReportAllocs()
+		var sum uint16
+		for n := 0; n < b.N; n++ {
+			for pc := uint16(0x200); pc < 0xFFE; pc += 2 {
+				sum += m.fetch(pc)
+			}
+		}
+		_ = sum
+	})
+	b.Run("slice", func(b *testing.B) {
+		m := newSliceFramebuffer()
+		b.ReportAllocs()
+		var sum uint16
+		for n := 0; n < b.N; n++ {
+			for pc := uint16(0x200); pc < 0xFFE; pc += 2 {
+				sum += m.fetch(pc)
+			}
+		}
+		_ = sum
+	})
+}
+
+// BenchmarkDrawHeavyROM is the baseline for the real thing, running drawHeavyROM.
+func BenchmarkDrawHeavyROM(b *testing.B) {
+	c := newTestChip8(b, drawHeavyROM...)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := c.cycle(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"os"
+	"time"
+)
+
+// gifPalette draws set pixels white on black.
+var gifPalette = color.Palette{color.Black, color.White}
+
+// GIFRecorder is a Renderer that records the frames it's given as an animated GIF, passing
+// everything on to Next, if it's set, so the game can still be seen while it's recorded.
+type GIFRecorder struct {
+	Next Renderer
+
+	path      string
+	anim      *gif.GIF
+	lastFrame time.Time
+	// owed is the time the last frame has been on screen that hasn't made it into a delay yet
+	owed time.Duration
+}
+
+// StartRecording begins recording to a new GIF, to be written to path by StopRecording.
+func (r *GIFRecorder) StartRecording(path string) {
+	r.path = path
+	r.anim = &gif.GIF{}
+	r.owed = 0
+}
+
+// StopRecording ends the recording and writes the GIF to the path given to StartRecording.
+func (r *GIFRecorder) StopRecording() error {
+	if r.anim == nil {
+		return fmt.Errorf("not recording")
+	}
+	anim := r.anim
+	r.anim = nil
+	if len(anim.Image) == 0 {
+		return fmt.Errorf("nothing was drawn while recording")
+	}
+	r.finishFrame(anim)
+
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	if err := gif.EncodeAll(f, anim); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func (r *GIFRecorder) Draw(gfx []byte, width, height int) {
+	if r.anim != nil {
+		r.addFrame(gfx, width, height)
+	}
+	if r.Next != nil {
+		r.Next.Draw(gfx, width, height)
+	}
+}
+
+func (r *GIFRecorder) Beep(on bool) {
+	if r.Next != nil {
+		r.Next.Beep(on)
+	}
+}
+
+// addFrame appends the display to the animation. The GIF is the size of the first frame, and
+// any drawn at the other resolution are scaled to fit.
+func (r *GIFRecorder) addFrame(gfx []byte, width, height int) {
+	if len(r.anim.Image) == 0 {
+		r.anim.Config = image.Config{ColorModel: gifPalette, Width: width, Height: height}
+	} else {
+		r.finishFrame(r.anim)
+	}
+
+	w, h := r.anim.Config.Width, r.anim.Config.Height
+	frame := image.NewPaletted(image.Rect(0, 0, w, h), gifPalette)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			frame.Pix[y*frame.Stride+x] = gfx[(y*height/h)*width+x*width/w]
+		}
+	}
+	r.anim.Image = append(r.anim.Image, frame)
+	r.anim.Delay = append(r.anim.Delay, 0)
+	r.lastFrame = time.Now()
+}
+
+// finishFrame sets how long the last frame in anim stays up, now that it's been replaced.
+// Frames last a whole number of 60Hz frames. GIF delays are in hundredths of a second, and
+// most viewers don't honour less than two, so the rounding is carried over to the next frame
+// to keep the clip in time.
+func (r *GIFRecorder) finishFrame(anim *gif.GIF) {
+	const frame = time.Second / 60
+	r.owed += time.Since(r.lastFrame)
+	frames := (r.owed + frame/2) / frame
+	if frames < 1 {
+		frames = 1
+	}
+	delay := int(frames * frame / (10 * time.Millisecond))
+	if delay < 2 {
+		delay = 2
+	}
+	anim.Delay[len(anim.Delay)-1] = delay
+	r.owed -= time.Duration(delay) * 10 * time.Millisecond
+	if r.owed < 0 {
+		r.owed = 0
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"image/gif"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGIFRecorder(t *testing.T) {
+	// (I is at digit 0) CLS; DRW V0, V0, 5; CLS; DRW V0, V0, 5; JP 0x208
+	c := newTestChip8(t, 0x00, 0xE0, 0xD0, 0x05, 0x00, 0xE0, 0xD0, 0x05, 0x12, 0x08)
+	r := &GIFRecorder{}
+	c.Renderer = r
+	path := filepath.Join(t.TempDir(), "clip.gif")
+	r.StartRecording(path)
+	emulate(t, c, 10)
+	if err := r.StopRecording(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	anim, err := gif.DecodeAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(anim.Image) != 4 || anim.Config.Width != 64 || anim.Config.Height != 32 {
+		t.Fatalf("%d frames at %dx%d, want 4 at 64x32", len(anim.Image), anim.Config.Width, anim.Config.Height)
+	}
+	for i, frame := range anim.Image {
+		// Alternately cleared and with the top left of the 0 drawn
+		if want := uint8(i % 2); frame.ColorIndexAt(0, 0) != want {
+			t.Errorf("frame %d has the top left pixel %d, want %d", i, frame.ColorIndexAt(0, 0), want)
+		}
+		if anim.Delay[i] < 2 {
+			t.Errorf("frame %d lasts %d hundredths of a second, want at least 2", i, anim.Delay[i])
+		}
+	}
+
+	if err := r.StopRecording(); err == nil {
+		t.Error("stopped recording twice")
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+// Result is the state of the machine at the end of a headless run.
+type Result struct {
+	V      [16]byte
+	I      uint16
+	PC     uint16
+	Memory [4096]byte
+
+	// Cycles is the number of instructions executed
+	Cycles int
+	// Halted is true if the program stopped by jumping to itself, rather than running out of cycles
+	Halted bool
+}
+
+// RunHeadless loads rom into a fresh machine and runs it as fast as possible, without rendering
+// or reading the keyboard, until it halts or maxCycles instructions have executed. This makes
+// it possible to use a ROM as a pure computation and inspect what it leaves behind.
+func RunHeadless(rom []byte, maxCycles int) (Result, error) {
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		return Result{}, err
+	}
+
+	var err error
+	cycles := 0
+	for ; cycles < maxCycles && !c.halted; cycles++ {
+		if err = c.cycle(); err != nil {
+			break
+		}
+	}
+
+	return Result{
+		V:      c.V,
+		I:      c.I,
+		PC:     c.pc,
+		Memory: c.memory,
+		Cycles: cycles,
+		Halted: c.halted,
+	}, err
+}
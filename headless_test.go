@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestRunHeadless(t *testing.T) {
+	// LD V0, 5; ADD V0, 3; ADD V0, V0; LD I, 0x123; JP 0x208
+	rom := []byte{0x60, 0x05, 0x70, 0x03, 0x80, 0x04, 0xA1, 0x23, 0x12, 0x08}
+	res, err := RunHeadless(rom, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.V[0] != 16 || res.V[0xF] != 0 || res.I != 0x123 {
+		t.Errorf("V0=%d VF=%d I=0x%03X, want V0=16 VF=0 I=0x123", res.V[0], res.V[0xF], res.I)
+	}
+	if !res.Halted || res.PC != 0x208 || res.Cycles != 5 {
+		t.Errorf("halted %v at 0x%03X after %d cycles, want halted at 0x208 after 5", res.Halted, res.PC, res.Cycles)
+	}
+	if res.Memory[0x200] != 0x60 {
+		t.Errorf("memory at 0x200 is 0x%02X, want the ROM", res.Memory[0x200])
+	}
+
+	res, err = RunHeadless(rom, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Halted || res.Cycles != 2 || res.V[0] != 8 {
+		t.Errorf("halted %v after %d cycles with V0=%d, want stopped after 2 with V0=8", res.Halted, res.Cycles, res.V[0])
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Intensity maps a pixel level, from 0 for off to 1 for fully on, to how bright it should be
+// shown after applying Config.Gamma and Config.Brightness. Levels in between come from
+// renderers that fade pixels out gradually rather than just switching them off.
+func (cfg *Config) Intensity(level float64) float64 {
+	level = math.Max(0, math.Min(1, level))
+	gamma := cfg.Gamma
+	if gamma <= 0 {
+		gamma = 1
+	}
+	return math.Min(1, cfg.Brightness*math.Pow(level, 1/gamma))
+}
+
+// PixelColor returns the RGB color to show a pixel at level in, blending from the background
+// color towards the foreground color by its Intensity. It's for renderers that aren't limited
+// to the terminal's colors, the terminal renderer itself only shows pixels fully on or off.
+func (cfg *Config) PixelColor(level float64) color.RGBA {
+	fr, fg, fb := attributeRGB(cfg.ForegroundColor, termbox.ColorWhite)
+	br, bg, bb := attributeRGB(cfg.BackgroundColor, termbox.ColorBlack)
+
+	t := cfg.Intensity(level)
+	blend := func(from, to int) uint8 {
+		return uint8(math.Round(float64(from) + (float64(to)-float64(from))*t))
+	}
+	return color.RGBA{R: blend(br, fr), G: blend(bg, fg), B: blend(bb, fb), A: 0xFF}
+}
+
+// attributeRGB looks up the RGB value of a terminal color, using fallback for the terminal's
+// default color.
+func attributeRGB(attr, fallback termbox.Attribute) (r, g, b int) {
+	if attr == termbox.ColorDefault {
+		attr = fallback
+	}
+	for _, color := range terminalColors {
+		if color.attr == attr {
+			return color.r, color.g, color.b
+		}
+	}
+	return 0, 0, 0
+}
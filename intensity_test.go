@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestIntensityMonotonic(t *testing.T) {
+	for _, tt := range []struct{ brightness, gamma float64 }{{1, 1}, {0.5, 1}, {1, 2.2}, {0.8, 0.5}} {
+		cfg := DefaultConfig()
+		cfg.Brightness, cfg.Gamma = tt.brightness, tt.gamma
+
+		if got := cfg.Intensity(0); got != 0 {
+			t.Errorf("brightness %v gamma %v: off is %v, want 0", tt.brightness, tt.gamma, got)
+		}
+		if got := cfg.Intensity(1); got != tt.brightness {
+			t.Errorf("brightness %v gamma %v: fully on is %v, want the brightness", tt.brightness, tt.gamma, got)
+		}
+		prev, prevColor := -1.0, cfg.PixelColor(0)
+		for level := 0.0; level <= 1; level += 1.0 / 16 {
+			got, color := cfg.Intensity(level), cfg.PixelColor(level)
+			if got <= prev {
+				t.Errorf("brightness %v gamma %v: level %v is %v, no brighter than the level before at %v", tt.brightness, tt.gamma, level, got, prev)
+			}
+			// The default colors are white on black, so every channel gets brighter together
+			if color.R < prevColor.R || color.G < prevColor.G || color.B < prevColor.B {
+				t.Errorf("brightness %v gamma %v: level %v is %v, darker than %v", tt.brightness, tt.gamma, level, color, prevColor)
+			}
+			prev, prevColor = got, color
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"image"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Keypad reports which of the 16 CHIP-8 keys are currently held down.
+type Keypad interface {
+	Down(key uint8) bool
+}
+
+// keyHoldTime is how long a key counts as held after the terminal reports a press. Terminals
+// don't report key releases, so holding a key relies on the terminal's key repeat topping
+// this up.
+const keyHoldTime = 200 * time.Millisecond
+
+// defaultKeyMap maps 1234/QWER/ASDF/ZXCV onto keys 0 to F in order.
+var defaultKeyMap = map[rune]uint8{
+	'1': 0x0, '2': 0x1, '3': 0x2, '4': 0x3,
+	'q': 0x4, 'w': 0x5, 'e': 0x6, 'r': 0x7,
+	'a': 0x8, 's': 0x9, 'd': 0xA, 'f': 0xB,
+	'z': 0xC, 'x': 0xD, 'c': 0xE, 'v': 0xF,
+}
+
+// arrowKeyMap maps the arrow keys onto 5/7/8/9, the up/left/down/right most action games use,
+// with space and enter as the 6 and 4 action buttons.
+var arrowKeyMap = map[termbox.Key]uint8{
+	termbox.KeyArrowUp:    0x5,
+	termbox.KeyArrowLeft:  0x7,
+	termbox.KeyArrowDown:  0x8,
+	termbox.KeyArrowRight: 0x9,
+	termbox.KeySpace:      0x6,
+	termbox.KeyEnter:      0x4,
+}
+
+// modernKeyMap goes with arrowKeyMap, letting the hex keys be typed directly for anything else.
+var modernKeyMap = map[rune]uint8{
+	'0': 0x0, '1': 0x1, '2': 0x2, '3': 0x3,
+	'4': 0x4, '5': 0x5, '6': 0x6, '7': 0x7,
+	'8': 0x8, '9': 0x9, 'a': 0xA, 'b': 0xB,
+	'c': 0xC, 'd': 0xD, 'e': 0xE, 'f': 0xF,
+}
+
+// TermboxKeypad is a Keypad driven by termbox key events, which must be passed to
+// HandleEvent. It's safe to use from the event loop and the emulator at the same time.
+type TermboxKeypad struct {
+	mu       sync.Mutex
+	keyMap   map[rune]uint8
+	specials map[termbox.Key]uint8
+	lastDown [16]time.Time
+}
+
+func NewTermboxKeypad() *TermboxKeypad {
+	return &TermboxKeypad{keyMap: defaultKeyMap}
+}
+
+// NewTermboxKeypadWithMap returns a keypad using keyMap, from the character typed to the
+// CHIP-8 key, in place of the default layout. Letters match either case.
+func NewTermboxKeypadWithMap(keyMap map[rune]uint8) *TermboxKeypad {
+	m := make(map[rune]uint8, len(keyMap))
+	for ch, key := range keyMap {
+		m[unicode.ToLower(ch)] = key & 0xF
+	}
+	return &TermboxKeypad{keyMap: m}
+}
+
+// SetProfile switches to one of the built in keyboard layouts.
+func (k *TermboxKeypad) SetProfile(p KeyProfile) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	switch p {
+	case KeysModern:
+		k.keyMap, k.specials = modernKeyMap, arrowKeyMap
+	default:
+		k.keyMap, k.specials = defaultKeyMap, nil
+	}
+}
+
+// applyKeyProfile switches the keypad, if it's a TermboxKeypad, to the layout in Config.KeyProfile.
+func (c *Chip8) applyKeyProfile() {
+	if keypad, ok := c.Keypad.(*TermboxKeypad); ok {
+		keypad.SetProfile(c.KeyProfile)
+	}
+}
+
+// HandleEvent records a key press from termbox, reporting whether it was a CHIP-8 key.
+func (k *TermboxKeypad) HandleEvent(ev termbox.Event) bool {
+	if ev.Type != termbox.EventKey {
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var key uint8
+	var ok bool
+	if ev.Ch != 0 {
+		key, ok = k.keyMap[unicode.ToLower(ev.Ch)]
+	} else {
+		key, ok = k.specials[ev.Key]
+	}
+	if !ok {
+		return false
+	}
+
+	k.lastDown[key] = time.Now()
+	return true
+}
+
+func (k *TermboxKeypad) Down(key uint8) bool {
+	if key > 0xF {
+		return false
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return time.Since(k.lastDown[key]) < keyHoldTime
+}
+
+// KeypadState returns whether each of the 16 keys is down, as of the last time the keypad
+// was read, keyed by its CHIP-8 value.
+func (c *Chip8) KeypadState() map[uint8]bool {
+	state := make(map[uint8]bool, len(c.keys))
+	for i, down := range c.keys {
+		state[uint8(i)] = down
+	}
+	return state
+}
+
+// The on-screen keypad is laid out in the same rows as defaultKeyMap, so each key appears
+// where it sits on the keyboard. Each cell is keypadCellWidth columns wide, with the label in
+// the middle.
+const (
+	keypadCellWidth = 3
+	keypadRows      = 4
+)
+
+// keypadLayout returns the terminal cell each key's label is drawn at, indexed by key, for an
+// on-screen keypad with its top left corner at (left, top).
+func keypadLayout(left, top int) [16]image.Point {
+	var cells [16]image.Point
+	for key := range cells {
+		row, col := key/4, key%4
+		cells[key] = image.Pt(left+col*keypadCellWidth+keypadCellWidth/2, top+row)
+	}
+	return cells
+}
+
+// drawKeypad renders the keypad with its top left corner at (left, top), highlighting the
+// keys that are down. It's skipped if the terminal is too small to fit all of it.
+func (c *Chip8) drawKeypad(left, top int) {
+	termWidth, termHeight := termbox.Size()
+	if left+4*keypadCellWidth > termWidth || top+keypadRows > termHeight {
+		return
+	}
+
+	state := c.KeypadState()
+	for key, pt := range keypadLayout(left, top) {
+		fg, bg := c.ForegroundColor, c.BackgroundColor
+		if state[uint8(key)] {
+			fg, bg = bg, fg
+		}
+		label := rune("0123456789ABCDEF"[key])
+		for dx := -keypadCellWidth / 2; dx <= keypadCellWidth/2; dx++ {
+			termbox.SetCell(pt.X+dx, pt.Y, ' ', fg, bg)
+		}
+		termbox.SetCell(pt.X, pt.Y, label, fg, bg)
+	}
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"image"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+// fakeKeypad is a Keypad with the keys held down set directly.
+type fakeKeypad [16]bool
+
+func (k *fakeKeypad) Down(key uint8) bool { return k[key] }
+
+func TestKeypadLayout(t *testing.T) {
+	want := [16]image.Point{
+		{1, 33}, {4, 33}, {7, 33}, {10, 33},
+		{1, 34}, {4, 34}, {7, 34}, {10, 34},
+		{1, 35}, {4, 35}, {7, 35}, {10, 35},
+		{1, 36}, {4, 36}, {7, 36}, {10, 36},
+	}
+	if got := keypadLayout(0, 33); got != want {
+		t.Errorf("keypadLayout(0, 33) = %v, want %v", got, want)
+	}
+	for key, pt := range keypadLayout(5, 2) {
+		if want := want[key].Add(image.Pt(5, 2-33)); pt != want {
+			t.Errorf("keypadLayout(5, 2) puts key %X at %v, want %v", key, pt, want)
+		}
+	}
+}
+
+func TestKeypadRedrawnWhenKeysChange(t *testing.T) {
+	c := newTestChip8(t, 0x12, 0x00)
+	keys := &fakeKeypad{}
+	c.Keypad = keys
+	c.ShowKeypad = true
+
+	for _, tt := range []struct {
+		key  uint8
+		down bool
+		draw bool
+	}{
+		{0x5, true, true},
+		{0x5, true, false},
+		{0xA, true, true},
+		{0x5, false, true},
+		{0xA, false, true},
+		{0xA, false, false},
+	} {
+		keys[tt.key] = tt.down
+		c.drawFlag = false
+		c.pollKeys()
+		if c.drawFlag != tt.draw {
+			t.Errorf("key %X down=%v: draw flag %v, want %v", tt.key, tt.down, c.drawFlag, tt.draw)
+		}
+	}
+
+	c.ShowKeypad = false
+	keys[0x1] = true
+	c.drawFlag = false
+	c.pollKeys()
+	if c.drawFlag {
+		t.Error("draw flag set for a key change with the keypad hidden")
+	}
+}
+
+func TestDefaultKeypadIsTermbox(t *testing.T) {
+	c := NewChip8()
+	keypad, ok := c.Keypad.(*TermboxKeypad)
+	if !ok {
+		t.Fatalf("default keypad is a %T, want a *TermboxKeypad", c.Keypad)
+	}
+	c.Renderer = NullRenderer{}
+	c.Initialize()
+	// LD V5, 5; SKP V5; LD V0, 1; LD V1, 1
+	if err := c.LoadGameBytes([]byte{0x65, 0x05, 0xE5, 0x9E, 0x60, 0x01, 0x61, 0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !keypad.HandleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'W'}) {
+		t.Fatal("W isn't a key")
+	}
+	if keypad.HandleEvent(termbox.Event{Type: termbox.EventKey, Ch: 'p'}) {
+		t.Error("P is a key")
+	}
+	c.pollKeys()
+	step(t, c, 3)
+	if c.V[0] != 0 || c.V[1] != 1 {
+		t.Errorf("V0=%d V1=%d, want SKP to have seen key 5 held down and skipped setting V0", c.V[0], c.V[1])
+	}
+}
+
+func TestKeypadWithMap(t *testing.T) {
+	keypad := NewTermboxKeypadWithMap(map[rune]uint8{'J': 0x2, 'k': 0x8, 'l': 0xE})
+	c := newTestChip8(t)
+	c.Keypad = keypad
+
+	for _, ch := range []rune{'j', 'K', '1'} {
+		keypad.HandleEvent(termbox.Event{Type: termbox.EventKey, Ch: ch})
+	}
+	got := c.getKeyState()
+	var want [16]bool
+	want[0x2], want[0x8] = true, true
+	if got != want {
+		t.Errorf("getKeyState() = %v, want just keys 2 and 8 down", got)
+	}
+}
+
+func TestKeypadState(t *testing.T) {
+	c := newTestChip8(t)
+	keys := &fakeKeypad{}
+	c.Keypad = keys
+	keys[0x3], keys[0xC] = true, true
+	c.pollKeys()
+
+	state := c.KeypadState()
+	if len(state) != 16 {
+		t.Fatalf("%d keys in the state, want 16", len(state))
+	}
+	for key, down := range state {
+		if want := key == 0x3 || key == 0xC; down != want {
+			t.Errorf("key %X down %v, want %v", key, down, want)
+		}
+	}
+}
+
+func TestKeyProfiles(t *testing.T) {
+	key := func(ch rune) termbox.Event { return termbox.Event{Type: termbox.EventKey, Ch: ch} }
+	special := func(k termbox.Key) termbox.Event { return termbox.Event{Type: termbox.EventKey, Key: k} }
+	const none = 0xFF
+
+	tests := []struct {
+		profile KeyProfile
+		ev      termbox.Event
+		want    uint8
+	}{
+		{KeysClassic, key('1'), 0x0},
+		{KeysClassic, key('4'), 0x3},
+		{KeysClassic, key('q'), 0x4},
+		{KeysClassic, key('s'), 0x9},
+		{KeysClassic, key('v'), 0xF},
+		{KeysClassic, key('0'), none},
+		{KeysClassic, special(termbox.KeyArrowUp), none},
+
+		{KeysModern, special(termbox.KeyArrowUp), 0x5},
+		{KeysModern, special(termbox.KeyArrowLeft), 0x7},
+		{KeysModern, special(termbox.KeyArrowDown), 0x8},
+		{KeysModern, special(termbox.KeyArrowRight), 0x9},
+		{KeysModern, special(termbox.KeySpace), 0x6},
+		{KeysModern, special(termbox.KeyEnter), 0x4},
+		{KeysModern, key('0'), 0x0},
+		{KeysModern, key('7'), 0x7},
+		{KeysModern, key('F'), 0xF},
+		{KeysModern, key('q'), none},
+	}
+	for _, tt := range tests {
+		k := NewTermboxKeypad()
+		k.SetProfile(tt.profile)
+		ok := k.HandleEvent(tt.ev)
+		if tt.want == none {
+			if ok {
+				t.Errorf("profile %v: %+v is a key, want it ignored", tt.profile, tt.ev)
+			}
+			continue
+		}
+		if !ok || !k.Down(tt.want) {
+			t.Errorf("profile %v: %+v doesn't press key %X", tt.profile, tt.ev, tt.want)
+		}
+		for other := uint8(0); other < 16; other++ {
+			if other != tt.want && k.Down(other) {
+				t.Errorf("profile %v: %+v also presses key %X", tt.profile, tt.ev, other)
+			}
+		}
+	}
+}
@@ -2,50 +2,288 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"context"
+	"flag"
 	"fmt"
+	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	termbox "github.com/nsf/termbox-go"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		panic("you must provide a path to a chip8 file")
+	debug := flag.Bool("debug", false, "start in the debugger, before running the ROM, and return to it if the ROM fails")
+	showKeypad := flag.Bool("keypad", false, "show the keypad below the display")
+	showStatus := flag.Bool("status", false, "show a status line below the display")
+	record := flag.String("record", "", "record a demo of the run to this file")
+	tracePath := flag.String("trace", "", "log every instruction executed to this file")
+	tone := flag.Bool("tone", false, "play the beep as a square wave tone through aplay, rather than the terminal bell")
+	gifPath := flag.String("gif", "", "record what's drawn to this file as an animated GIF")
+	verify := flag.String("verify", "", "replay the demo in this file without a display, checking every frame matches")
+	keys := flag.String("keys", "", "the keyboard layout, classic or modern")
+	scale := flag.Int("scale", 0, "draw each pixel as a block of this many terminal cells across and down")
+	speed := flag.Int("speed", 0, "instructions to run per second, in place of the default of 540 or the ROM's own setting")
+	disasm := flag.String("disasm", "", "write the disassembly of the ROM to this file, or - for stdout, instead of running it")
+	rplPath := flag.String("rpl", defaultRPLPath(), "where to save the SCHIP RPL user flags between runs, blank to not save them")
+	selfTest := flag.Bool("selftest", false, "check the opcode decoder and disassembler agree before starting")
+	playlistPath := flag.String("playlist", "", "run each of the ROMs listed in this file in turn, instead of a single ROM")
+	flag.Parse()
+
+	if *selfTest {
+		problems := SelfTest()
+		for _, problem := range problems {
+			fmt.Fprintf(os.Stderr, "self test: %s\n", problem)
+		}
+		if len(problems) > 0 {
+			os.Exit(1)
+		}
 	}
 
-	f, err := os.Open(os.Args[1])
-	if err != nil {
-		panic(fmt.Sprintf("error opening file: %v", err))
+	if *disasm != "" {
+		if flag.NArg() < 1 {
+			panic("you must provide a path to a chip8 file")
+		}
+		if err := writeDisassembly(flag.Arg(0), *disasm); err != nil {
+			panic(err)
+		}
+		return
+	}
+
+	// Settings given on the command line, which take precedence over any that come with a ROM
+	if *scale < 0 {
+		panic(fmt.Sprintf("invalid scale %d", *scale))
+	}
+	if *speed < 0 {
+		panic(fmt.Sprintf("invalid speed %d", *speed))
+	}
+	profile, ok := keyProfileNames[strings.ToLower(*keys)]
+	if *keys != "" && !ok {
+		panic(fmt.Sprintf("unknown key profile %q", *keys))
+	}
+	overrides := func(cfg *Config) {
+		if *showKeypad {
+			cfg.ShowKeypad = true
+		}
+		if *showStatus {
+			cfg.ShowStatus = true
+		}
+		if *scale > 0 {
+			cfg.PixelScale = *scale
+		}
+		if *speed > 0 {
+			cfg.ClockHz = *speed
+		}
+		if *keys != "" {
+			cfg.KeyProfile = profile
+		}
 	}
-	defer f.Close()
 
 	// initialize the chip 8 system and load the game into memory
 	myChip8 := NewChip8()
-	myChip8.Initialize()
-	myChip8.LoadGame(bufio.NewReader(f))
+
+	// Anything written to stderr while termbox is running gets mangled, so hold on to the
+	// warnings and print them once the terminal has been restored.
+	var warnings bytes.Buffer
+	myChip8.Log = log.New(&warnings, "chip8: ", 0)
+	defer func() { os.Stderr.Write(warnings.Bytes()) }()
+
+	if *playlistPath != "" {
+		paths, err := ReadPlaylist(*playlistPath)
+		if err != nil {
+			panic(fmt.Sprintf("error reading playlist: %v", err))
+		}
+		if err := myChip8.SetPlaylist(paths, overrides); err != nil {
+			panic(err)
+		}
+	} else {
+		if flag.NArg() < 1 {
+			panic("you must provide a path to a chip8 file")
+		}
+		if err := myChip8.LoadROMFile(flag.Arg(0)); err != nil {
+			panic(err)
+		}
+		overrides(&myChip8.Config)
+		myChip8.applyKeyProfile()
+	}
+
+	if *verify != "" {
+		demo, err := LoadDemo(*verify)
+		if err != nil {
+			panic(fmt.Sprintf("error loading demo: %v", err))
+		}
+		if err := myChip8.Replay(demo); err != nil {
+			fmt.Fprintf(os.Stderr, "replay diverged: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("replayed %d frames, all matched\n", len(demo.Hashes))
+		return
+	}
+
+	if *debug {
+		resume, err := NewDebugger(myChip8, os.Stdout).Run(os.Stdin)
+		if err != nil {
+			panic(fmt.Sprintf("error reading debugger input: %v", err))
+		}
+		if !resume {
+			return
+		}
+	}
+
+	if *rplPath != "" {
+		if err := myChip8.LoadRPL(*rplPath); err != nil && !os.IsNotExist(err) {
+			panic(fmt.Sprintf("error loading RPL flags: %v", err))
+		}
+		defer func() {
+			if err := os.MkdirAll(filepath.Dir(*rplPath), 0755); err != nil {
+				fmt.Fprintf(os.Stderr, "error saving RPL flags: %v\n", err)
+			} else if err := myChip8.SaveRPL(*rplPath); err != nil {
+				fmt.Fprintf(os.Stderr, "error saving RPL flags: %v\n", err)
+			}
+		}()
+	}
+
+	if *record != "" {
+		myChip8.StartRecording(time.Now().UnixNano())
+		defer func() {
+			if err := SaveDemo(*record, myChip8.StopRecording()); err != nil {
+				fmt.Fprintf(os.Stderr, "error saving demo: %v\n", err)
+			}
+		}()
+	}
+
+	if *tracePath != "" {
+		f, err := os.Create(*tracePath)
+		if err != nil {
+			panic(fmt.Sprintf("error creating trace: %v", err))
+		}
+		w := bufio.NewWriter(f)
+		myChip8.Tracer = WriterTracer(w)
+		defer func() {
+			if err := w.Flush(); err != nil {
+				fmt.Fprintf(os.Stderr, "error writing trace: %v\n", err)
+			}
+			f.Close()
+		}()
+	}
+
+	if *tone {
+		out, err := StartAplay()
+		if err != nil {
+			panic(fmt.Sprintf("error starting aplay: %v", err))
+		}
+		r := &ToneRenderer{Next: myChip8.Renderer, Out: out}
+		myChip8.Renderer = r
+		defer func() {
+			r.Beep(false)
+			out.Close()
+		}()
+	}
+
+	if *gifPath != "" {
+		rec := &GIFRecorder{Next: myChip8.Renderer}
+		rec.StartRecording(*gifPath)
+		myChip8.Renderer = rec
+		defer func() {
+			if err := rec.StopRecording(); err != nil {
+				fmt.Fprintf(os.Stderr, "error saving GIF: %v\n", err)
+			}
+		}()
+	}
+
+	if *debug {
+		myChip8.PauseOnError = true
+		// Deferred before termbox.Close, so this runs once the terminal has been restored
+		defer func() {
+			if myChip8.Fault() != nil {
+				if _, err := NewDebugger(myChip8, os.Stdout).Run(os.Stdin); err != nil {
+					fmt.Fprintf(os.Stderr, "error reading debugger input: %v\n", err)
+				}
+			}
+		}()
+	}
 
 	termbox.Init()
 	defer termbox.Close()
 
-	exiting := false
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
+	// Esc quits, F5 pauses and resumes, and F6 runs one instruction at a time while paused
 	go func() {
 		for {
-			if k := termbox.PollEvent(); k.Type == termbox.EventKey && k.Key == termbox.KeyEsc {
-				exiting = true
+			k := termbox.PollEvent()
+			if k.Type == termbox.EventKey && k.Key == termbox.KeyEsc {
+				cancel()
+			} else if k.Type == termbox.EventKey && k.Key == termbox.KeyF5 {
+				myChip8.Do(togglePause)
+			} else if k.Type == termbox.EventKey && k.Key == termbox.KeyF6 {
+				myChip8.Do(stepOnce)
+			} else if keypad, ok := myChip8.Keypad.(*TermboxKeypad); ok {
+				keypad.HandleEvent(k)
 			}
 		}
 	}()
 
-	for {
-		if exiting {
-			break
-		}
+	// With -debug, Run returns on an error so it can be looked at in the debugger above
+	if err := myChip8.Run(ctx); err != nil {
+		panic(err)
+	}
+}
 
-		myChip8.EmulateCycle()
+func togglePause(c *Chip8) {
+	if c.Paused {
+		c.Resume()
+	} else {
+		c.Pause()
+	}
+}
+
+func stepOnce(c *Chip8) {
+	if !c.Paused {
+		return
+	}
+	// A fault stops Run, with -debug
+	if _, err := c.Step(); err != nil && c.Fault() == nil {
+		panic(err)
+	}
+}
+
+// defaultRPLPath is where RPL user flags are kept unless -rpl says otherwise.
+func defaultRPLPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "chip8", "rpl.json")
+}
+
+// writeDisassembly disassembles the ROM at romPath into the file at out, or stdout if it's -.
+func writeDisassembly(romPath, out string) error {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+	if _, program, ok := ParseOctoMetadata(rom); ok {
+		rom = program
+	}
+
+	if out == "-" {
+		return WriteDisassembly(os.Stdout, rom)
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	if err := WriteDisassembly(f, rom); err != nil {
+		f.Close()
+		return err
 	}
+	return f.Close()
 }
 
 func init() {
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/nsf/termbox-go"
+)
+
+// octoMagic marks the end of a ROM carrying Octo metadata. The layout is:
+//
+//	<program bytes> <metadata JSON> <JSON length, 2 bytes big endian> "OCTO"
+//
+// The JSON uses the same option names as Octo itself.
+var octoMagic = []byte("OCTO")
+
+// Metadata is the subset of Octo's options that this emulator understands.
+type Metadata struct {
+	Title string `json:"title"`
+	// Tickrate is the number of instructions executed per 60Hz frame
+	Tickrate        int    `json:"tickrate"`
+	FillColor       string `json:"fillColor"`
+	BackgroundColor string `json:"backgroundColor"`
+}
+
+// ParseOctoMetadata looks for Octo metadata appended to rom. If there is some it's returned
+// along with the program bytes on their own and ok is true, otherwise rom is returned as is.
+func ParseOctoMetadata(rom []byte) (meta *Metadata, program []byte, ok bool) {
+	trailer := len(octoMagic) + 2
+	if len(rom) < trailer || !bytes.HasSuffix(rom, octoMagic) {
+		return nil, rom, false
+	}
+
+	size := int(binary.BigEndian.Uint16(rom[len(rom)-trailer:]))
+	start := len(rom) - trailer - size
+	if start < 0 {
+		return nil, rom, false
+	}
+
+	meta = &Metadata{}
+	if err := json.Unmarshal(rom[start:len(rom)-trailer], meta); err != nil {
+		return nil, rom, false
+	}
+	return meta, rom[:start], true
+}
+
+// Apply configures cfg with the settings in the metadata that are present.
+func (m *Metadata) Apply(cfg *Config) {
+	if m.Tickrate > 0 {
+		cfg.ClockHz = m.Tickrate * 60
+	}
+	if color, ok := nearestColor(m.FillColor); ok {
+		cfg.ForegroundColor = color
+	}
+	if color, ok := nearestColor(m.BackgroundColor); ok {
+		cfg.BackgroundColor = color
+	}
+}
+
+// The RGB values of the basic terminal colors, roughly as most terminals show them
+var terminalColors = []struct {
+	attr    termbox.Attribute
+	r, g, b int
+}{
+	{termbox.ColorBlack, 0x00, 0x00, 0x00},
+	{termbox.ColorRed, 0xCD, 0x00, 0x00},
+	{termbox.ColorGreen, 0x00, 0xCD, 0x00},
+	{termbox.ColorYellow, 0xCD, 0xCD, 0x00},
+	{termbox.ColorBlue, 0x00, 0x00, 0xEE},
+	{termbox.ColorMagenta, 0xCD, 0x00, 0xCD},
+	{termbox.ColorCyan, 0x00, 0xCD, 0xCD},
+	{termbox.ColorWhite, 0xE5, 0xE5, 0xE5},
+}
+
+// nearestColor finds the terminal color closest to a "#RRGGBB" string.
+func nearestColor(hex string) (termbox.Attribute, bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return 0, false
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	r, g, b := int(rgb>>16), int(rgb>>8&0xFF), int(rgb&0xFF)
+
+	best, bestDist := termbox.ColorDefault, -1
+	for _, color := range terminalColors {
+		dist := (r-color.r)*(r-color.r) + (g-color.g)*(g-color.g) + (b-color.b)*(b-color.b)
+		if bestDist < 0 || dist < bestDist {
+			best, bestDist = color.attr, dist
+		}
+	}
+	return best, true
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nsf/termbox-go"
+)
+
+// withOctoMetadata appends json to program in the layout ParseOctoMetadata reads.
+func withOctoMetadata(program []byte, json string) []byte {
+	rom := append(append([]byte{}, program...), json...)
+	rom = append(rom, byte(len(json)>>8), byte(len(json)))
+	return append(rom, octoMagic...)
+}
+
+func TestParseOctoMetadata(t *testing.T) {
+	program := []byte{0x60, 0x01, 0x12, 0x02}
+	rom := withOctoMetadata(program, `{"title":"Demo","tickrate":20,"fillColor":"#FF2000","backgroundColor":"#000010"}`)
+
+	meta, got, ok := ParseOctoMetadata(rom)
+	if !ok {
+		t.Fatal("no metadata found")
+	}
+	if !bytes.Equal(got, program) {
+		t.Errorf("program % X, want % X", got, program)
+	}
+	if *meta != (Metadata{Title: "Demo", Tickrate: 20, FillColor: "#FF2000", BackgroundColor: "#000010"}) {
+		t.Errorf("metadata %+v", *meta)
+	}
+
+	cfg := DefaultConfig()
+	meta.Apply(&cfg)
+	if cfg.ClockHz != 1200 || cfg.ForegroundColor != termbox.ColorRed || cfg.BackgroundColor != termbox.ColorBlack {
+		t.Errorf("clock %d, foreground %v, background %v, want 1200, red and black", cfg.ClockHz, cfg.ForegroundColor, cfg.BackgroundColor)
+	}
+}
+
+func TestParseOctoMetadataAbsent(t *testing.T) {
+	for _, rom := range [][]byte{
+		{0x60, 0x01, 0x12, 0x02},
+		[]byte("OCTO"),
+		withOctoMetadata([]byte{0x12, 0x00}, `{"tickrate":`),
+		append([]byte{0xFF, 0xFF}, octoMagic...),
+	} {
+		if meta, got, ok := ParseOctoMetadata(rom); ok || meta != nil || !bytes.Equal(got, rom) {
+			t.Errorf("% X: found metadata %+v, or didn't return the ROM as is", rom, meta)
+		}
+	}
+}
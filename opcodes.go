@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// unknownOpcodeError is returned when decodeOpcode doesn't recognise an instruction.
+type unknownOpcodeError uint16
+
+func (e unknownOpcodeError) Error() string {
+	return fmt.Sprintf("unknown opcode: 0x%X", uint16(e))
+}
+
+// PCOutOfRangeError is returned when pc has run off the end of memory, so there's no whole
+// instruction to fetch. It's usually the fallout of a bad jump or a program with no ending
+// loop.
+type PCOutOfRangeError uint16
+
+func (e PCOutOfRangeError) Error() string {
+	return fmt.Sprintf("pc 0x%X is past the end of memory", uint16(e))
+}
+
+// OpcodeSpec describes an instruction: any opcode where opcode&Mask == Pattern. Name is the
+// mnemonic the disassembler gives it.
+type OpcodeSpec struct {
+	Pattern, Mask uint16
+	Name          string
+}
+
+// SupportedOpcodes lists every instruction the emulator runs. 01NN isn't included as it's
+// only an instruction with Config.BankSwitching turned on. The SUPER-CHIP instructions are,
+// though they need the SCHIPInstructions quirk, which the default settings have.
+var SupportedOpcodes = []OpcodeSpec{
+	{0x00C0, 0xFFF0, "SCD"},
+	{0x00E0, 0xFFFF, "CLS"},
+	{0x00EE, 0xFFFF, "RET"},
+	{0x00FB, 0xFFFF, "SCR"},
+	{0x00FC, 0xFFFF, "SCL"},
+	{0x00FD, 0xFFFF, "EXIT"},
+	{0x00FE, 0xFFFF, "LOW"},
+	{0x00FF, 0xFFFF, "HIGH"},
+	{0x1000, 0xF000, "JP"},
+	{0x2000, 0xF000, "CALL"},
+	{0x3000, 0xF000, "SE"},
+	{0x4000, 0xF000, "SNE"},
+	{0x5000, 0xF00F, "SE"},
+	{0x6000, 0xF000, "LD"},
+	{0x7000, 0xF000, "ADD"},
+	{0x8000, 0xF00F, "LD"},
+	{0x8001, 0xF00F, "OR"},
+	{0x8002, 0xF00F, "AND"},
+	{0x8003, 0xF00F, "XOR"},
+	{0x8004, 0xF00F, "ADD"},
+	{0x8005, 0xF00F, "SUB"},
+	{0x8006, 0xF00F, "SHR"},
+	{0x8007, 0xF00F, "SUBN"},
+	{0x800E, 0xF00F, "SHL"},
+	{0x9000, 0xF00F, "SNE"},
+	{0xA000, 0xF000, "LD"},
+	{0xB000, 0xF000, "JP"},
+	{0xC000, 0xF000, "RND"},
+	{0xD000, 0xF000, "DRW"},
+	{0xE09E, 0xF0FF, "SKP"},
+	{0xE0A1, 0xF0FF, "SKNP"},
+	{0xF007, 0xF0FF, "LD"},
+	{0xF00A, 0xF0FF, "LD"},
+	{0xF015, 0xF0FF, "LD"},
+	{0xF018, 0xF0FF, "LD"},
+	{0xF01E, 0xF0FF, "ADD"},
+	{0xF029, 0xF0FF, "LD"},
+	{0xF030, 0xF0FF, "LD"},
+	{0xF033, 0xF0FF, "LD"},
+	{0xF055, 0xF0FF, "LD"},
+	{0xF065, 0xF0FF, "LD"},
+	{0xF075, 0xF0FF, "LD"},
+	{0xF085, 0xF0FF, "LD"},
+}
+
+// SelfTest checks that the decoder, the disassembler and SupportedOpcodes all agree on which
+// opcodes exist, returning a description of each disagreement.
+func SelfTest() []string {
+	return checkOpcodeTable(SupportedOpcodes)
+}
+
+func checkOpcodeTable(table []OpcodeSpec) []string {
+	var problems []string
+
+	// A machine to try each opcode on, copied fresh every time so they can't affect each other
+	template := NewChip8()
+	template.Keypad = nil
+	template.Initialize()
+
+	for op := 0; op <= 0xFFFF; op++ {
+		opcode := uint16(op)
+
+		var spec *OpcodeSpec
+		for i := range table {
+			if opcode&table[i].Mask == table[i].Pattern {
+				spec = &table[i]
+				break
+			}
+		}
+
+		m := *template
+		var unknown unknownOpcodeError
+		decoded := !errors.As(m.decodeOpcode(opcode), &unknown)
+		asm, disassembled := Mnemonic(opcode)
+
+		switch {
+		case spec == nil && decoded:
+			problems = append(problems, fmt.Sprintf("0x%04X is decoded but isn't in the opcode table", opcode))
+		case spec != nil && !decoded:
+			problems = append(problems, fmt.Sprintf("0x%04X matches %s in the opcode table but isn't decoded", opcode, spec.Name))
+		case spec == nil && disassembled:
+			problems = append(problems, fmt.Sprintf("0x%04X is disassembled as %q but isn't in the opcode table", opcode, asm))
+		case spec != nil && !disassembled:
+			problems = append(problems, fmt.Sprintf("0x%04X matches %s in the opcode table but isn't disassembled", opcode, spec.Name))
+		case spec != nil && strings.Fields(asm)[0] != spec.Name:
+			problems = append(problems, fmt.Sprintf("0x%04X is disassembled as %q but the opcode table calls it %s", opcode, asm, spec.Name))
+		}
+
+		// One problem is usually repeated across a whole range of opcodes, so don't go on forever
+		if len(problems) >= 20 {
+			problems = append(problems, "too many problems, giving up")
+			break
+		}
+	}
+	return problems
+}
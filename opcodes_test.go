@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestSelfTest(t *testing.T) {
+	for _, problem := range SelfTest() {
+		t.Error(problem)
+	}
+}
+
+func TestSelfTestFindsDesyncedTable(t *testing.T) {
+	// with edits the table as though it had drifted from the decoder and disassembler
+	with := func(edit func([]OpcodeSpec) []OpcodeSpec) []OpcodeSpec {
+		return edit(append([]OpcodeSpec(nil), SupportedOpcodes...))
+	}
+	tests := []struct {
+		name  string
+		table []OpcodeSpec
+		want  string
+	}{
+		{"missing", with(func(table []OpcodeSpec) []OpcodeSpec {
+			for i, spec := range table {
+				if spec.Name == "SHR" {
+					return append(table[:i], table[i+1:]...)
+				}
+			}
+			return table
+		}), "0x8006 is decoded but isn't in the opcode table"},
+		{"extra", with(func(table []OpcodeSpec) []OpcodeSpec {
+			return append(table, OpcodeSpec{0x5001, 0xF00F, "SE"})
+		}), "0x5001 matches SE in the opcode table but isn't decoded"},
+		{"misnamed", with(func(table []OpcodeSpec) []OpcodeSpec {
+			for i := range table {
+				if table[i].Name == "XOR" {
+					table[i].Name = "OR"
+				}
+			}
+			return table
+		}), `0x8003 is disassembled as "XOR V[0], V[0]" but the opcode table calls it OR`},
+	}
+	for _, tt := range tests {
+		problems := checkOpcodeTable(tt.table)
+		if len(problems) == 0 || problems[0] != tt.want {
+			t.Errorf("%s: got problems %q, want the first to be %q", tt.name, problems, tt.want)
+		}
+	}
+}
+
+// switchHandler finds the handler for opcode with a nested switch, the way decodeOpcode did
+// before the dispatch tables, or returns nil if the opcode is unknown.
+func switchHandler(c *Chip8, opcode uint16) opcodeHandler {
+	switch opcode & 0xF000 {
+	case 0x0000:
+		if c.BankSwitching && opcode&0x0F00 == 0x0100 {
+			return op01NN
+		}
+		switch opcode {
+		case 0x00E0:
+			return op00E0
+		case 0x00EE:
+			return op00EE
+		}
+		if !c.Quirks.SCHIPInstructions {
+			break
+		}
+		if opcode&0xFFF0 == 0x00C0 {
+			return op00CN
+		}
+		switch opcode {
+		case 0x00FB:
+			return op00FB
+		case 0x00FC:
+			return op00FC
+		case 0x00FD:
+			return op00FD
+		case 0x00FE:
+			return op00FE
+		case 0x00FF:
+			return op00FF
+		}
+	case 0x1000:
+		return op1NNN
+	case 0x2000:
+		return op2NNN
+	case 0x3000:
+		return op3XNN
+	case 0x4000:
+		return op4XNN
+	case 0x5000:
+		if opcode&0x000F == 0 {
+			return op5XY0
+		}
+	case 0x6000:
+		return op6XNN
+	case 0x7000:
+		return op7XNN
+	case 0x8000:
+		switch opcode & 0x000F {
+		case 0x0:
+			return op8XY0
+		case 0x1:
+			return op8XY1
+		case 0x2:
+			return op8XY2
+		case 0x3:
+			return op8XY3
+		case 0x4:
+			return op8XY4
+		case 0x5:
+			return op8XY5
+		case 0x6:
+			return op8XY6
+		case 0x7:
+			return op8XY7
+		case 0xE:
+			return op8XYE
+		}
+	case 0x9000:
+		if opcode&0x000F == 0 {
+			return op9XY0
+		}
+	case 0xA000:
+		return opANNN
+	case 0xB000:
+		return opBNNN
+	case 0xC000:
+		return opCXNN
+	case 0xD000:
+		return opDXYN
+	case 0xE000:
+		switch opcode & 0x00FF {
+		case 0x9E:
+			return opEX9E
+		case 0xA1:
+			return opEXA1
+		}
+	case 0xF000:
+		switch opcode & 0x00FF {
+		case 0x07:
+			return opFX07
+		case 0x0A:
+			return opFX0A
+		case 0x15:
+			return opFX15
+		case 0x18:
+			return opFX18
+		case 0x1E:
+			return opFX1E
+		case 0x29:
+			return opFX29
+		case 0x33:
+			return opFX33
+		case 0x55:
+			return opFX55
+		case 0x65:
+			return opFX65
+		}
+		if !c.Quirks.SCHIPInstructions {
+			break
+		}
+		switch opcode & 0x00FF {
+		case 0x30:
+			return opFX30
+		case 0x75:
+			return opFX75
+		case 0x85:
+			return opFX85
+		}
+	}
+	return nil
+}
+
+func TestDispatchMatchesSwitch(t *testing.T) {
+	for _, setup := range []struct{ banked, schip bool }{
+		{false, true},
+		{true, true},
+		{false, false},
+	} {
+		template := NewChip8()
+		template.Renderer = NullRenderer{}
+		template.Keypad = nil
+		template.BankSwitching = setup.banked
+		template.Quirks.SCHIPInstructions = setup.schip
+		template.Initialize()
+		if setup.banked {
+			// Two banks, so 0101 has something to switch to
+			if err := template.LoadGameBytes(make([]byte, 0x1600)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		template.I = 0x300
+		for i := range template.V {
+			template.V[i] = byte(i * 17)
+		}
+
+		for op := 0; op <= 0xFFFF; op++ {
+			opcode := uint16(op)
+			if setup.banked && opcode >= 0x1000 {
+				// Only 0NNN depends on bank switching
+				break
+			}
+			if !setup.schip && opcode >= 0x1000 && opcode < 0xF000 {
+				// and only 0NNN and FXNN on the SUPER-CHIP instructions
+				continue
+			}
+			table, sw := *template, *template
+			table.Rand, sw.Rand = rand.New(rand.NewSource(1)), rand.New(rand.NewSource(1))
+			table.rplStore, sw.rplStore = nil, nil
+
+			tableErr := table.decodeOpcode(opcode)
+			var switchErr error = unknownOpcodeError(opcode)
+			if h := switchHandler(&sw, opcode); h != nil {
+				switchErr = h(&sw, opcode)
+			}
+
+			if fmt.Sprint(tableErr) != fmt.Sprint(switchErr) {
+				t.Fatalf("0x%04X with %+v: error %v, want %v", opcode, setup, tableErr, switchErr)
+			}
+			if table.memory != sw.memory || table.gfx != sw.gfx || table.V != sw.V || table.stack != sw.stack ||
+				table.I != sw.I || table.pc != sw.pc || table.sp != sw.sp || table.hires != sw.hires ||
+				table.delayTimer != sw.delayTimer || table.soundTimer != sw.soundTimer ||
+				table.halted != sw.halted || table.bank != sw.bank || !bytes.Equal(table.image, sw.image) {
+				t.Fatalf("0x%04X with %+v: the machine ends up differently to the switch", opcode, setup)
+			}
+		}
+	}
+}
+
+// decodeWorkload is a mix of common instructions that are safe to run over and over.
+var decodeWorkload = []uint16{
+	0x6012, 0x7101, 0x8124, 0x8006, 0xA300, 0x3000, 0x4001, 0x9010,
+	0xF01E, 0xF007, 0xE09E, 0x8013, 0xF015, 0x5010, 0x8127, 0xF029,
+}
+
+func BenchmarkDecode(b *testing.B) {
+	b.Run("table", func(b *testing.B) {
+		c := newTestChip8(b)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, opcode := range decodeWorkload {
+				c.decodeOpcode(opcode)
+			}
+		}
+	})
+	b.Run("switch", func(b *testing.B) {
+		c := newTestChip8(b)
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			for _, opcode := range decodeWorkload {
+				switchHandler(c, opcode)(c, opcode)
+			}
+		}
+	})
+}
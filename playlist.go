@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// playlist cycles through a list of ROMs, for running demo reels.
+type playlist struct {
+	paths   []string
+	current int
+	// base is the Config each ROM starts from, so one ROM's settings don't carry over to the
+	// next, and overrides are applied on top of each ROM's own settings
+	base      Config
+	overrides func(*Config)
+}
+
+// SetPlaylist loads the first of the ROMs at paths and arranges for each one to run in turn
+// for Config.PlaylistDuration, or until it halts, looping back to the first after the last.
+// Each ROM is loaded like LoadROMFile, with its own settings, and then overrides, if it isn't
+// nil, gets to change them.
+func (c *Chip8) SetPlaylist(paths []string, overrides func(*Config)) error {
+	if len(paths) == 0 {
+		return fmt.Errorf("the playlist is empty")
+	}
+
+	p := &playlist{paths: paths, base: c.Config, overrides: overrides}
+	if err := p.load(c); err != nil {
+		return err
+	}
+	c.playlist = p
+	return nil
+}
+
+// advance moves on to the next ROM once the current one has had its turn.
+func (p *playlist) advance(c *Chip8) error {
+	elapsed := time.Duration(c.cycles) * time.Second / time.Duration(c.clockHz())
+	if !c.halted && elapsed < c.PlaylistDuration {
+		return nil
+	}
+
+	p.current = (p.current + 1) % len(p.paths)
+	return p.load(c)
+}
+
+func (p *playlist) load(c *Chip8) error {
+	c.Config = p.base
+	if err := c.LoadROMFile(p.paths[p.current]); err != nil {
+		return fmt.Errorf("playlist: %v", err)
+	}
+	if p.overrides != nil {
+		p.overrides(&c.Config)
+	}
+	c.applyKeyProfile()
+	return nil
+}
+
+// ReadPlaylist reads a playlist file listing one ROM path per line. Blank lines and lines
+// starting with # are ignored, and relative paths are relative to the playlist file.
+func ReadPlaylist(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var paths []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !filepath.IsAbs(line) {
+			line = filepath.Join(filepath.Dir(path), line)
+		}
+		paths = append(paths, line)
+	}
+	return paths, scanner.Err()
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeROMs writes each ROM to a file in a temporary directory, returning their paths.
+func writeROMs(t *testing.T, roms map[string][]byte) map[string]string {
+	t.Helper()
+	dir := t.TempDir()
+	paths := make(map[string]string, len(roms))
+	for name, rom := range roms {
+		paths[name] = filepath.Join(dir, name)
+		if err := os.WriteFile(paths[name], rom, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return paths
+}
+
+// emulate runs n cycles through EmulateCycle, as main does.
+func emulate(t *testing.T, c *Chip8, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := c.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestPlaylistAdvances(t *testing.T) {
+	paths := writeROMs(t, map[string][]byte{
+		// ADD V0, 1; JP 0x200
+		"a.ch8": {0x70, 0x01, 0x12, 0x00},
+		// ADD V1, 1; JP 0x200
+		"b.ch8": {0x71, 0x01, 0x12, 0x00},
+	})
+	c := newTestChip8(t)
+	c.ClockHz = 1000
+	c.PlaylistDuration = 20 * time.Millisecond
+	if err := c.SetPlaylist([]string{paths["a.ch8"], paths["b.ch8"]}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	emulate(t, c, 19)
+	if c.Name != "a.ch8" || c.V[0] == 0 {
+		t.Fatalf("running %s with V0=%d before the first ROM's 20 cycles are up, want a.ch8 running", c.Name, c.V[0])
+	}
+	emulate(t, c, 1)
+	if c.Name != "b.ch8" || c.pc != 0x200 || c.V[0] != 0 {
+		t.Fatalf("running %s at 0x%03X with V0=%d after 20 cycles, want b.ch8 loaded fresh", c.Name, c.pc, c.V[0])
+	}
+	emulate(t, c, 10)
+	if c.Name != "b.ch8" || c.V[1] == 0 {
+		t.Fatalf("running %s with V1=%d, want b.ch8 running", c.Name, c.V[1])
+	}
+	emulate(t, c, 10)
+	if c.Name != "a.ch8" {
+		t.Errorf("running %s after the last ROM's turn, want it to loop back to a.ch8", c.Name)
+	}
+}
+
+func TestPlaylistSkipsHaltedROM(t *testing.T) {
+	paths := writeROMs(t, map[string][]byte{
+		"halt.ch8": {0x12, 0x00},
+		"spin.ch8": {0x70, 0x01, 0x12, 0x00},
+	})
+	c := newTestChip8(t)
+	c.ClockHz = 1000
+	c.PlaylistDuration = time.Hour
+	if err := c.SetPlaylist([]string{paths["halt.ch8"], paths["spin.ch8"]}, nil); err != nil {
+		t.Fatal(err)
+	}
+	emulate(t, c, 1)
+	if c.Name != "spin.ch8" {
+		t.Errorf("running %s after the first ROM halted, want spin.ch8", c.Name)
+	}
+}
+
+func TestPlaylistAppliesEachROMsSettings(t *testing.T) {
+	paths := writeROMs(t, map[string][]byte{
+		// JP 0x200, halting at once so the next ROM is loaded
+		"a.ch8":     withOctoMetadata([]byte{0x12, 0x00}, `{"tickrate":20}`),
+		"a.ch8.cfg": []byte("show_status = true\n"),
+		"b.ch8":     {0x70, 0x01, 0x12, 0x00},
+	})
+	c := newTestChip8(t)
+	c.ClockHz = 1000
+	c.PlaylistDuration = time.Hour
+	overrides := func(cfg *Config) { cfg.PixelScale = 2 }
+	if err := c.SetPlaylist([]string{paths["a.ch8"], paths["b.ch8"]}, overrides); err != nil {
+		t.Fatal(err)
+	}
+	if c.ClockHz != 1200 || !c.ShowStatus || c.PixelScale != 2 {
+		t.Fatalf("a.ch8 has ClockHz=%d ShowStatus=%v PixelScale=%d, want its metadata, its .cfg and the overrides applied",
+			c.ClockHz, c.ShowStatus, c.PixelScale)
+	}
+
+	emulate(t, c, 1)
+	if c.Name != "b.ch8" {
+		t.Fatalf("running %s after the first ROM halted, want b.ch8", c.Name)
+	}
+	if c.ClockHz != 1000 || c.ShowStatus || c.PixelScale != 2 {
+		t.Errorf("b.ch8 has ClockHz=%d ShowStatus=%v PixelScale=%d, want a.ch8's settings gone and the overrides kept",
+			c.ClockHz, c.ShowStatus, c.PixelScale)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/nsf/termbox-go"
+)
+
+// Renderer shows the display and plays the sound for a machine, so the emulator can run
+// inside something other than a terminal.
+type Renderer interface {
+	// Draw shows the display. gfx holds width x height pixels, row by row, one byte each
+	// that's 1 for a set pixel. It's only valid until Draw returns.
+	Draw(gfx []byte, width, height int)
+	// Beep starts the tone when on is true, and stops it when it's false. The tone plays for
+	// as long as the sound timer is running.
+	Beep(on bool)
+}
+
+// TermboxRenderer draws to the terminal through termbox, with the colours and extras, such
+// as the keypad and status line, configured on its machine. It has no audio of its own. Its
+// beep is the terminal bell, rung once as each tone starts, however long the sound timer runs
+// for; ToneRenderer plays a proper tone.
+type TermboxRenderer struct {
+	c *Chip8
+}
+
+func NewTermboxRenderer(c *Chip8) *TermboxRenderer {
+	return &TermboxRenderer{c: c}
+}
+
+func (r *TermboxRenderer) Draw(gfx []byte, width, height int) {
+	c := r.c
+	termbox.Clear(termbox.ColorDefault, termbox.ColorDefault)
+
+	scale := c.pixelScale(width, height)
+	c.drawDisplay(gfx, width, height, scale, func(x, y int, bg termbox.Attribute) {
+		termbox.SetCell(x, y, ' ', termbox.ColorDefault, bg)
+	})
+
+	if c.ShowKeypad {
+		// Leave a blank row between the display and the keypad
+		c.drawKeypad(0, height*scale+1)
+	}
+	if c.ShowStatus {
+		c.drawStatus()
+	}
+	if c.ShowBeep {
+		// Leave a blank column between the display and the indicator
+		drawBeep(width*scale+1, 0, beepIndicator(c.soundTimer))
+	}
+	termbox.Flush()
+}
+
+// drawDisplay lays gfx out in terminal cells, each pixel a scale x scale block from the top
+// left corner, calling setCell with the colour of each cell: Config.ForegroundColor for set
+// pixels and Config.BackgroundColor for the rest.
+func (c *Chip8) drawDisplay(gfx []byte, width, height, scale int, setCell func(x, y int, bg termbox.Attribute)) {
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			if gfx[(y/scale*width)+x/scale] == 1 {
+				setCell(x, y, c.ForegroundColor)
+			} else {
+				setCell(x, y, c.BackgroundColor)
+			}
+		}
+	}
+}
+
+// pixelScale is how many terminal cells across and down each pixel of a width x height display
+// takes up: Config.PixelScale, reduced if need be so the whole display fits in the terminal.
+func (c *Chip8) pixelScale(width, height int) int {
+	scale := c.PixelScale
+	termWidth, termHeight := termbox.Size()
+	for scale > 1 && (width*scale > termWidth || height*scale > termHeight) {
+		scale--
+	}
+	if scale < 1 {
+		scale = 1
+	}
+	return scale
+}
+
+// Beep rings the terminal bell as the tone starts. Printing the bell character doesn't disturb
+// the display, but the terminal decides what it sounds like and for how long, so there's
+// nothing to do when the tone stops. Wrap the renderer in a ToneRenderer for a tone that lasts
+// as long as the sound timer.
+func (r *TermboxRenderer) Beep(on bool) {
+	if on {
+		fmt.Print("\a")
+	}
+}
+
+// ShouldDraw reports whether the display has changed since it was last drawn. With no
+// Renderer, EmulateCycle leaves this alone, so a loop drawing the display itself can check it
+// and call ClearDrawFlag once it has.
+func (c *Chip8) ShouldDraw() bool {
+	return c.drawFlag
+}
+
+// ClearDrawFlag marks the display as drawn, see ShouldDraw.
+func (c *Chip8) ClearDrawFlag() {
+	c.drawFlag = false
+}
+
+// NullRenderer discards everything, for running without a display.
+type NullRenderer struct{}
+
+func (NullRenderer) Draw(gfx []byte, width, height int) {}
+
+func (NullRenderer) Beep(on bool) {}
+
+// HeadlessRenderer keeps what it's given instead of showing it, so a harness can check what
+// a program drew and when it beeped.
+type HeadlessRenderer struct {
+	// Frame is a copy of the last display drawn, Width x Height pixels
+	Frame         []byte
+	Width, Height int
+	// Beeps has an entry for every time the tone started (true) or stopped (false)
+	Beeps []bool
+}
+
+func (r *HeadlessRenderer) Draw(gfx []byte, width, height int) {
+	r.Frame = append(r.Frame[:0], gfx...)
+	r.Width, r.Height = width, height
+}
+
+func (r *HeadlessRenderer) Beep(on bool) {
+	r.Beeps = append(r.Beeps, on)
+}
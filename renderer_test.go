@@ -0,0 +1,256 @@
+package main
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// drawHeavyROM does nothing but draw sprites across the hi-res display, one every third
+// instruction.
+var drawHeavyROM = []byte{
+	0x00, 0xFF, // 0x200: HIGH
+	0xA2, 0x10, // 0x202: LD I, 0x210
+	0xD0, 0x1F, // 0x204: DRW V0, V1, 15
+	0x70, 0x08, // 0x206: ADD V0, 0x08
+	0x71, 0x03, // 0x208: ADD V1, 0x03
+	0x12, 0x04, // 0x20A: JP 0x204
+	0x00, 0x00, 0x00, 0x00,
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // 0x210: sprite
+	0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+}
+
+// countingRenderer counts the times it's asked to draw, each of which is a flush of the
+// terminal for TermboxRenderer, keeping the last display drawn.
+type countingRenderer struct {
+	draws int
+	frame []byte
+}
+
+func (r *countingRenderer) Draw(gfx []byte, width, height int) {
+	r.draws++
+	r.frame = append(r.frame[:0], gfx...)
+}
+
+func (r *countingRenderer) Beep(on bool) {}
+
+// BenchmarkRefreshHz compares how often the terminal would be flushed running drawHeavyROM,
+// drawing every change as it's made against holding them back to 60 redraws a second.
+func BenchmarkRefreshHz(b *testing.B) {
+	for _, tt := range []struct {
+		name      string
+		refreshHz int
+	}{
+		{"unbuffered", 0},
+		{"60Hz", 60},
+	} {
+		b.Run(tt.name, func(b *testing.B) {
+			c := newTestChip8(b, drawHeavyROM...)
+			r := &countingRenderer{}
+			c.Renderer = r
+			c.RefreshHz = tt.refreshHz
+			// As fast as the sleeps allow
+			c.ClockHz = 1000000
+			b.ResetTimer()
+			for n := 0; n < b.N; n++ {
+				if err := c.EmulateCycle(); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(r.draws)/float64(b.N), "flushes/op")
+		})
+	}
+}
+
+func TestSpritesBetweenRendersDrawnTogether(t *testing.T) {
+	// (I is at digit 0) DRW V0, V1, 5; LD V0, 10; DRW V0, V1, 5; LD V0, 20; DRW V0, V1, 5; then spin
+	c := newTestChip8(t, 0xD0, 0x15, 0x60, 0x0A, 0xD0, 0x15, 0x60, 0x14, 0xD0, 0x15, 0x12, 0x0A)
+	r := &countingRenderer{}
+	c.Renderer = r
+	for i := 0; i < 5; i++ {
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if r.draws != 0 {
+		t.Fatalf("%d renders before EmulateCycle, want none", r.draws)
+	}
+
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	if r.draws != 1 {
+		t.Errorf("%d renders for three sprites, want 1", r.draws)
+	}
+	for _, x := range []int{0, 10, 20} {
+		if r.frame[x] == 0 {
+			t.Errorf("sprite at x=%d missing from the render", x)
+		}
+	}
+}
+
+// slowRenderer takes longer than a couple of frames to draw, like a slow terminal.
+type slowRenderer struct {
+	countingRenderer
+	delay time.Duration
+}
+
+func (r *slowRenderer) Draw(gfx []byte, width, height int) {
+	time.Sleep(r.delay)
+	r.countingRenderer.Draw(gfx, width, height)
+}
+
+func TestMaxFrameSkip(t *testing.T) {
+	const frames, skip = 30, 2
+	c := newTestChip8(t, drawHeavyROM...)
+	r := &slowRenderer{delay: 3 * time.Second / 60}
+	c.Renderer = r
+	c.MaxFrameSkip = skip
+
+	emulate(t, c, frames*c.cyclesPerFrame())
+	// Every frame draws, but rendering takes three frames, so it's always behind
+	if max := frames/(skip+1) + 1; r.draws > max || r.draws == 0 {
+		t.Errorf("%d renders over %d frames with %d skipped in a row, want between 1 and %d", r.draws, frames, skip, max)
+	}
+}
+
+func TestRendererIsSwappable(t *testing.T) {
+	c := NewChip8()
+	if _, ok := c.Renderer.(*TermboxRenderer); !ok {
+		t.Errorf("default renderer is a %T, want a *TermboxRenderer", c.Renderer)
+	}
+
+	// (I is at digit 0) DRW V0, V0, 5; LD V0, 2; LD ST, V0; JP 0x206
+	c = newTestChip8(t, 0xD0, 0x05, 0x60, 0x02, 0xF0, 0x18, 0x12, 0x06)
+	if _, ok := c.Renderer.(NullRenderer); !ok {
+		t.Fatalf("test renderer is a %T, want a NullRenderer", c.Renderer)
+	}
+	emulate(t, c, 2*c.cyclesPerFrame())
+	if c.ShouldDraw() || c.gfx[0] == 0 {
+		t.Errorf("sprite wasn't rendered with a NullRenderer")
+	}
+
+	// and the same ROM goes to whatever renderer is set
+	r := &countingRenderer{}
+	c = newTestChip8(t, 0xD0, 0x05, 0x60, 0x02, 0xF0, 0x18, 0x12, 0x06)
+	c.Renderer = r
+	emulate(t, c, 2*c.cyclesPerFrame())
+	if r.draws == 0 || r.frame[0] == 0 {
+		t.Errorf("%d renders, want the sprite drawn", r.draws)
+	}
+}
+
+func TestDisplayDirty(t *testing.T) {
+	// (I is at digit 0) DRW V0, V0, 5; LD V0, 1; CLS; with the render in between
+	c := newTestChip8(t, 0xD0, 0x05, 0x60, 0x01, 0x00, 0xE0)
+	for _, want := range []struct {
+		asm   string
+		dirty bool
+	}{
+		{"DRW V0, V0, 5", true},
+		{"LD V0, 1", false},
+		{"CLS", true},
+	} {
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+		if c.DisplayDirty() != want.dirty {
+			t.Errorf("DisplayDirty() = %v after %s, want %v", !want.dirty, want.asm, want.dirty)
+		}
+		// Rendering doesn't clear it
+		c.ClearDrawFlag()
+		if c.DisplayDirty() != want.dirty {
+			t.Errorf("DisplayDirty() changed by rendering after %s", want.asm)
+		}
+	}
+}
+
+func TestShouldDrawAfterClear(t *testing.T) {
+	// LD V0, 1; CLS; JP 0x204
+	c := newTestChip8(t, 0x60, 0x01, 0x00, 0xE0, 0x12, 0x04)
+	// An external loop draws the display itself
+	c.Renderer = nil
+	c.ClearDrawFlag()
+
+	for _, want := range []bool{false, true, true} {
+		if err := c.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+		if c.ShouldDraw() != want {
+			t.Errorf("ShouldDraw() = %v at 0x%03X, want %v", !want, c.pc, want)
+		}
+	}
+	c.ClearDrawFlag()
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	if c.ShouldDraw() {
+		t.Error("ShouldDraw() still true once the display was drawn")
+	}
+}
+
+// displayCells records the colour drawDisplay gives each terminal cell.
+func displayCells(c *Chip8, gfx []byte, width, height, scale int) map[image.Point]termbox.Attribute {
+	cells := make(map[image.Point]termbox.Attribute)
+	c.drawDisplay(gfx, width, height, scale, func(x, y int, bg termbox.Attribute) {
+		cells[image.Pt(x, y)] = bg
+	})
+	return cells
+}
+
+func TestDisplayColours(t *testing.T) {
+	c := newTestChip8(t)
+	c.ForegroundColor, c.BackgroundColor = termbox.ColorGreen, termbox.ColorBlue
+	gfx := make([]byte, 64*32)
+	gfx[0], gfx[3*64+5] = 1, 1
+
+	cells := displayCells(c, gfx, 64, 32, 1)
+	if len(cells) != 64*32 {
+		t.Fatalf("drew %d cells, want 2048", len(cells))
+	}
+	for pt, bg := range cells {
+		want := termbox.ColorBlue
+		if pt == image.Pt(0, 0) || pt == image.Pt(5, 3) {
+			want = termbox.ColorGreen
+		}
+		if bg != want {
+			t.Errorf("cell %v is colour %d, want %d", pt, bg, want)
+		}
+	}
+}
+
+func TestPixelScaleCells(t *testing.T) {
+	c := newTestChip8(t)
+	c.ForegroundColor, c.BackgroundColor = termbox.ColorWhite, termbox.ColorBlack
+	gfx := make([]byte, 64*32)
+	gfx[2*64+3] = 1
+
+	const scale = 3
+	cells := displayCells(c, gfx, 64, 32, scale)
+	if len(cells) != 64*32*scale*scale {
+		t.Fatalf("drew %d cells, want %d", len(cells), 64*32*scale*scale)
+	}
+	var set []image.Point
+	for y := 0; y < 32*scale; y++ {
+		for x := 0; x < 64*scale; x++ {
+			if cells[image.Pt(x, y)] == termbox.ColorWhite {
+				set = append(set, image.Pt(x, y))
+			}
+		}
+	}
+	// Pixel (3, 2) covers cells 9-11 across and 6-8 down
+	want := []image.Point{
+		{9, 6}, {10, 6}, {11, 6},
+		{9, 7}, {10, 7}, {11, 7},
+		{9, 8}, {10, 8}, {11, 8},
+	}
+	if !reflect.DeepEqual(set, want) {
+		t.Errorf("set cells %v, want %v", set, want)
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LoadROMFile loads the ROM at romPath along with any settings that go with it: those in an
+// Octo metadata trailer, then those in a .cfg file alongside it, or for a .zip those in the
+// cartridge. The settings are applied on top of the ones already in Config.
+func (c *Chip8) LoadROMFile(romPath string) error {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return fmt.Errorf("error opening file: %v", err)
+	}
+
+	if strings.EqualFold(filepath.Ext(romPath), ".zip") {
+		return c.LoadCartridge(bytes.NewReader(rom), int64(len(rom)))
+	}
+
+	// Octo ROMs can carry their own settings
+	if meta, program, ok := ParseOctoMetadata(rom); ok {
+		meta.Apply(&c.Config)
+		rom = program
+	}
+
+	// Pick up per-game settings from a sidecar file next to the ROM, if there is one
+	if err := LoadConfigFile(romPath+".cfg", &c.Config); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error loading config: %v", err)
+	}
+
+	if missing := RequiredFeatures(rom).Unsupported(); len(missing) > 0 {
+		c.warnf("%s uses %s, which may not work", filepath.Base(romPath), strings.Join(missing, ", "))
+	}
+
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		return fmt.Errorf("error loading %s: %v", romPath, err)
+	}
+	c.Name = filepath.Base(romPath)
+	return nil
+}
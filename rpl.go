@@ -0,0 +1,67 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// romHash returns the key a ROM's RPL flags are saved under.
+func romHash(rom []byte) string {
+	sum := sha1.Sum(rom)
+	return hex.EncodeToString(sum[:])
+}
+
+// RPLFlags returns the SCHIP RPL user flags of the loaded ROM, as set by FX75.
+func (c *Chip8) RPLFlags() [16]byte {
+	return c.rplStore[c.romHash]
+}
+
+// LoadRPL reads RPL user flags saved by SaveRPL, so that ROMs find them as they left them. If
+// the file doesn't exist the returned error satisfies os.IsNotExist.
+func (c *Chip8) LoadRPL(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var store map[string][16]byte
+	if err := json.Unmarshal(data, &store); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	if c.rplStore == nil {
+		c.rplStore = make(map[string][16]byte)
+	}
+	for hash, flags := range store {
+		c.rplStore[hash] = flags
+	}
+	return nil
+}
+
+// SaveRPL writes the RPL user flags of every ROM that has set them to the file at path. Flags
+// already in the file for other ROMs are kept. If there are no flags at all nothing is written.
+func (c *Chip8) SaveRPL(path string) error {
+	if len(c.rplStore) == 0 {
+		return nil
+	}
+
+	store := make(map[string][16]byte)
+	if data, err := os.ReadFile(path); err == nil {
+		if err := json.Unmarshal(data, &store); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	for hash, flags := range c.rplStore {
+		store[hash] = flags
+	}
+	data, err := json.Marshal(store)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
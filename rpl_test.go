@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRPLPersists(t *testing.T) {
+	// LD V0, 0xAA; LD V1, 0xBB; LD R, V1; JP 0x206
+	rom := []byte{0x60, 0xAA, 0x61, 0xBB, 0xF1, 0x75, 0x12, 0x06}
+	want := [16]byte{0xAA, 0xBB}
+
+	c := newTestChip8(t, rom...)
+	step(t, c, 3)
+	if got := c.RPLFlags(); got != want {
+		t.Fatalf("got flags % X, want % X", got, want)
+	}
+
+	// Reloading the ROM in the same machine keeps them
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	if got := c.RPLFlags(); got != want {
+		t.Errorf("got flags % X after reloading, want % X", got, want)
+	}
+
+	// And so does saving them for the next run
+	path := filepath.Join(t.TempDir(), "rpl.json")
+	if err := c.SaveRPL(path); err != nil {
+		t.Fatal(err)
+	}
+	next := newTestChip8(t, rom...)
+	if err := next.LoadRPL(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := next.RPLFlags(); got != want {
+		t.Errorf("got flags % X in the next run, want % X", got, want)
+	}
+
+	// They belong to the ROM that set them
+	other := newTestChip8(t, 0x12, 0x00)
+	if err := other.LoadRPL(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := other.RPLFlags(); got != ([16]byte{}) {
+		t.Errorf("got flags % X for a different ROM, want none", got)
+	}
+}
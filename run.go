@@ -0,0 +1,45 @@
+package main
+
+import "context"
+
+// Run emulates until ctx is cancelled, Stop is called or, with Config.PauseOnError, an
+// instruction fails, and then returns nil. If EmulateCycle returns an error, Run stops and
+// returns it.
+func (c *Chip8) Run(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case f := <-c.requests:
+			f(c)
+			continue
+		default:
+		}
+
+		if c.Stopped() || c.fault != nil {
+			return nil
+		}
+		if err := c.EmulateCycle(); err != nil {
+			return err
+		}
+	}
+}
+
+// Do queues f to be called by Run between cycles. This lets another goroutine, such as a UI
+// event loop, change the machine safely while it runs. The machine must have been made by
+// NewChip8.
+func (c *Chip8) Do(f func(*Chip8)) {
+	c.requests <- f
+}
+
+// RunN runs up to n cycles as fast as possible, without rendering, reading the keypad or
+// sleeping. It returns early if the program halts, the machine is paused or stopped, or an
+// instruction fails, so it always finishes and is repeatable for a given ROM and Rand seed.
+func (c *Chip8) RunN(n int) error {
+	for i := 0; i < n && !c.halted && !c.Paused && !c.Stopped(); i++ {
+		if err := c.cycle(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
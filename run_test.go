@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// FuzzRunN runs arbitrary bytes as a ROM, which may fail but must never panic.
+func FuzzRunN(f *testing.F) {
+	f.Add([]byte{0xAF, 0xFF, 0xF1, 0x55})
+	f.Add([]byte{0xAF, 0xFF, 0xF1, 0x65})
+	f.Add([]byte{0xAF, 0xFF, 0x60, 0xFF, 0xF0, 0x1E, 0xF0, 0x55})
+	f.Add([]byte{0x22, 0x00})
+	f.Add([]byte{0x00, 0xEE})
+
+	f.Fuzz(func(t *testing.T, rom []byte) {
+		c := NewChip8()
+		c.Renderer = NullRenderer{}
+		c.Initialize()
+		if err := c.LoadGameBytes(rom); err != nil {
+			return
+		}
+		c.RunN(10000)
+	})
+}
+
+func TestRunNStopsOnOutOfRangeLoadStore(t *testing.T) {
+	tests := []struct {
+		name string
+		rom  []byte
+	}{
+		{"store at 0xFFF", []byte{0xAF, 0xFF, 0xF1, 0x55}},
+		{"load at 0xFFF", []byte{0xAF, 0xFF, 0xF1, 0x65}},
+		{"store after FX1E pushes I past 0xFFF", []byte{0xAF, 0xFF, 0x60, 0xFF, 0xF0, 0x1E, 0xF0, 0x55}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewChip8()
+			c.Renderer = NullRenderer{}
+			c.Initialize()
+			if err := c.LoadGameBytes(tt.rom); err != nil {
+				t.Fatal(err)
+			}
+			if err := c.RunN(10); err == nil {
+				t.Errorf("RunN returned no error")
+			}
+		})
+	}
+}
+
+func TestRunNStopsOnHalt(t *testing.T) {
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Initialize()
+	// 6001 7001 1204: count in V0, then jump to the jump
+	if err := c.LoadGameBytes([]byte{0x60, 0x01, 0x70, 0x01, 0x12, 0x04}); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.RunN(1000); err != nil {
+		t.Fatal(err)
+	}
+	if !c.halted || c.V[0] != 2 || c.cycles != 3 {
+		t.Errorf("halted %v, V0 %d after %d cycles, want halted with V0 2 after 3", c.halted, c.V[0], c.cycles)
+	}
+}
+
+func TestStopMakesCyclesNoOps(t *testing.T) {
+	// ADD V0, 1; JP 0x200
+	c := newTestChip8(t, 0x70, 0x01, 0x12, 0x00)
+	c.soundTimer = 10
+	if err := c.EmulateCycle(); err != nil {
+		t.Fatal(err)
+	}
+	c.Stop()
+	before := c.SaveState()
+	for i := 0; i < 10; i++ {
+		if err := c.EmulateCycle(); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !c.Stopped() || !bytes.Equal(c.SaveState(), before) {
+		t.Errorf("stopped %v with V0=%d, want nothing run after Stop", c.Stopped(), c.V[0])
+	}
+}
+
+func TestRunReturnsWhenCancelled(t *testing.T) {
+	c := newTestChip8(t, 0x12, 0x00)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.Run(ctx) }()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v, want nil once cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run still going a second after it was cancelled")
+	}
+}
+
+// TestStopFromAnotherGoroutine is meant for go test -race: the exit signal crosses goroutines,
+// the way Esc on the keypad stops main's loop.
+func TestStopFromAnotherGoroutine(t *testing.T) {
+	c := newTestChip8(t, 0x70, 0x01, 0x12, 0x00)
+	done := make(chan error)
+	go func() { done <- c.Run(context.Background()) }()
+
+	ran := make(chan byte)
+	c.Do(func(c *Chip8) { ran <- c.V[0] })
+	<-ran
+	go c.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v, want nil once stopped", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Run still going a second after Stop")
+	}
+}
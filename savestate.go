@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"io"
+)
+
+// savedStateVersion is the snapshot format SaveState writes. Version 0 snapshots, from before
+// the field was added, kept the address of each call instruction on the stack rather than the
+// address to return to.
+const savedStateVersion = 1
+
+// savedState is the machine state kept by SaveState, with the fields exported for
+// encoding/gob.
+type savedState struct {
+	Version int
+
+	Memory             [4096]byte
+	V                  [16]byte
+	I, PC, SP, Opcode  uint16
+	Stack, CallTargets [16]uint16
+
+	Gfx   [hiResWidth * hiResHeight]byte
+	HiRes bool
+
+	DelayTimer, LastDelayTimer, SoundTimer uint8
+	Keys, PrevKeys                         [16]bool
+
+	// The full bank switched image, and the bank mapped in, see Config.BankSwitching
+	Image []byte
+	Bank  int
+
+	Halted, WaitingForFrame bool
+	Cycles                  int
+
+	// ROMHash identifies the ROM loaded when the state was saved, see LoadGameWithState
+	ROMHash string
+}
+
+// SaveState snapshots the whole machine: memory, registers, stack, display, timers and keys.
+// LoadState puts it back. The settings in Config and the loaded ROM aren't included, and
+// neither is the state of the random number generator, so CXNN will differ after a restore
+// unless Chip8.RandomSource is set.
+func (c *Chip8) SaveState() []byte {
+	s := savedState{
+		Version: savedStateVersion, Memory: c.memory, V: c.V,
+		I: c.I, PC: c.pc, SP: c.sp, Opcode: c.opcode,
+		Stack: c.stack, CallTargets: c.callTargets,
+		Gfx: c.gfx, HiRes: c.hires,
+		DelayTimer: c.delayTimer, LastDelayTimer: c.lastDelayTimer, SoundTimer: c.soundTimer,
+		Keys: c.keys, PrevKeys: c.prevKeys,
+		Image: c.image, Bank: c.bank,
+		Halted: c.halted, WaitingForFrame: c.waitingForFrame,
+		Cycles: c.cycles, ROMHash: c.romHash,
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s); err != nil {
+		// Everything in savedState can be encoded, so this can't happen
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// LoadState restores a snapshot made by SaveState. The machine is left alone if the snapshot
+// can't be read.
+func (c *Chip8) LoadState(data []byte) error {
+	s, err := decodeState(data)
+	if err != nil {
+		return err
+	}
+	c.restoreState(s)
+	return nil
+}
+
+// LoadGameWithState loads rom in the same way as LoadGame and then, unless state is nil,
+// restores a snapshot made by SaveState so a previous session can carry on. It's an error for
+// the snapshot to have been saved with a different ROM loaded, in which case the ROM is left
+// ready to run from the beginning.
+func (c *Chip8) LoadGameWithState(rom, state io.Reader) error {
+	if err := c.LoadGame(rom); err != nil {
+		return err
+	}
+	if state == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(state)
+	if err != nil {
+		return fmt.Errorf("error reading state: %v", err)
+	}
+	s, err := decodeState(data)
+	if err != nil {
+		return err
+	}
+	if s.ROMHash != c.romHash {
+		return fmt.Errorf("state was saved with a different ROM loaded")
+	}
+	c.restoreState(s)
+	return nil
+}
+
+// decodeState reads and checks a snapshot made by SaveState, bringing one made by an older
+// version up to date.
+func decodeState(data []byte) (savedState, error) {
+	var s savedState
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&s); err != nil {
+		return s, fmt.Errorf("error reading state: %v", err)
+	}
+	if s.Version > savedStateVersion {
+		return s, fmt.Errorf("error reading state: version %d is newer than this emulator supports", s.Version)
+	}
+	if int(s.SP) > len(s.Stack) {
+		return s, fmt.Errorf("error reading state: stack pointer %d is out of range", s.SP)
+	}
+	if int(s.PC) >= len(s.Memory)-1 {
+		return s, fmt.Errorf("error reading state: pc 0x%03X is out of range", s.PC)
+	}
+	if s.Image == nil {
+		if s.Bank != 0 {
+			return s, fmt.Errorf("error reading state: bank %d is mapped without a bank switched image", s.Bank)
+		}
+	} else {
+		if len(s.Image) < len(s.Memory) || (len(s.Image)-bankedAddress)%bankSize != 0 {
+			return s, fmt.Errorf("error reading state: bank switched image is %d bytes, which isn't a whole number of banks", len(s.Image))
+		}
+		if banks := (len(s.Image) - bankedAddress) / bankSize; s.Bank < 0 || s.Bank >= banks {
+			return s, fmt.Errorf("error reading state: bank %d is out of range, the image has %d", s.Bank, banks)
+		}
+	}
+	if s.Version == 0 {
+		for i := 0; i < int(s.SP); i++ {
+			s.Stack[i] += 2
+		}
+		s.Version = savedStateVersion
+	}
+	return s, nil
+}
+
+// restoreState puts the machine back to the snapshot s.
+func (c *Chip8) restoreState(s savedState) {
+	c.memory, c.V = s.Memory, s.V
+	c.I, c.pc, c.sp, c.opcode = s.I, s.PC, s.SP, s.Opcode
+	c.stack, c.callTargets = s.Stack, s.CallTargets
+	c.gfx, c.hires = s.Gfx, s.HiRes
+	c.delayTimer, c.lastDelayTimer, c.soundTimer = s.DelayTimer, s.LastDelayTimer, s.SoundTimer
+	c.keys, c.prevKeys = s.Keys, s.PrevKeys
+	c.image, c.bank = s.Image, s.Bank
+	c.halted, c.waitingForFrame = s.Halted, s.WaitingForFrame
+	c.cycles = s.Cycles
+
+	// The undo log describes how the machine got to where it was, which no longer applies
+	c.undoLog = nil
+	c.fault = nil
+	c.drawFlag = true
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+)
+
+func TestLoadStateMigratesVersion0Stack(t *testing.T) {
+	c := newTestChip8(t, callROM...)
+	step(t, c, 1)
+
+	// Rewrite the snapshot the way it was saved before it had a version, with the address of
+	// the call instruction on the stack
+	s, err := decodeState(c.SaveState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Version = 0
+	s.Stack[0] -= 2
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s); err != nil {
+		t.Fatal(err)
+	}
+
+	c = newTestChip8(t, callROM...)
+	if err := c.LoadState(buf.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	step(t, c, 2)
+	if c.PC() != 0x202 {
+		t.Errorf("pc 0x%03X returning from a call restored from a version 0 state, want 0x202", c.PC())
+	}
+}
+
+func TestLoadStateRejectsNewerVersion(t *testing.T) {
+	c := newTestChip8(t, callROM...)
+	s, err := decodeState(c.SaveState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Version = savedStateVersion + 1
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.LoadState(buf.Bytes()); err == nil {
+		t.Error("loaded a state from a newer version")
+	}
+}
+
+func TestLoadStateRejectsCorruptSave(t *testing.T) {
+	// An 8KB bank switched image, so there are 3 banks
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Keypad = nil
+	c.BankSwitching = true
+	c.Initialize()
+	if err := c.LoadGameBytes(make([]byte, 0x2000-0x200)); err != nil {
+		t.Fatal(err)
+	}
+	saved := c.SaveState()
+
+	tests := []struct {
+		name    string
+		corrupt func(s *savedState)
+	}{
+		{"stack pointer past the stack", func(s *savedState) { s.SP = 17 }},
+		{"pc past the end of memory", func(s *savedState) { s.PC = 0xFFF }},
+		{"bank past the last", func(s *savedState) { s.Bank = 3 }},
+		{"negative bank", func(s *savedState) { s.Bank = -1 }},
+		{"truncated image", func(s *savedState) { s.Image = s.Image[:len(s.Image)-1] }},
+		{"image shorter than memory", func(s *savedState) { s.Image = s.Image[:bankedAddress] }},
+		{"bank without an image", func(s *savedState) { s.Image, s.Bank = nil, 1 }},
+	}
+	for _, tt := range tests {
+		s, err := decodeState(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tt.corrupt(&s)
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(&s); err != nil {
+			t.Fatal(err)
+		}
+		if err := c.LoadState(buf.Bytes()); err == nil {
+			t.Errorf("%s: loaded the state", tt.name)
+		}
+	}
+	if !bytes.Equal(c.SaveState(), saved) {
+		t.Error("a rejected state changed the machine")
+	}
+}
+
+func TestSaveStateRoundTrip(t *testing.T) {
+	c := newTestChip8(t, drawHeavyROM...)
+	c.delayTimer, c.soundTimer = 200, 100
+	runFrames(t, c, 3)
+	snapshot := c.SaveState()
+
+	runFrames(t, c, 5)
+	want, err := decodeState(c.SaveState())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.LoadState(snapshot); err != nil {
+		t.Fatal(err)
+	}
+	runFrames(t, c, 5)
+	got, err := decodeState(c.SaveState())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("running on from the restored snapshot reached a different state")
+	}
+	if got.DelayTimer != 200-8 || got.Cycles != 8*c.cyclesPerFrame() {
+		t.Errorf("delay timer %d after %d cycles, want the timers and cycles restored too", got.DelayTimer, got.Cycles)
+	}
+}
+
+func TestLoadGameWithState(t *testing.T) {
+	c := newTestChip8(t, callROM...)
+	step(t, c, 2)
+	state := c.SaveState()
+
+	// The same ROM carries on in the subroutine
+	c = newTestChip8(t)
+	if err := c.LoadGameWithState(bytes.NewReader(callROM), bytes.NewReader(state)); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != 0x208 || c.sp != 1 || c.V[0] != 1 {
+		t.Errorf("pc 0x%03X sp %d V0=%d, want the session restored at 0x208", c.pc, c.sp, c.V[0])
+	}
+
+	// Another ROM is refused, and left to run from the start
+	other := []byte{0x12, 0x00}
+	c = newTestChip8(t)
+	if err := c.LoadGameWithState(bytes.NewReader(other), bytes.NewReader(state)); err == nil {
+		t.Error("restored a state saved with a different ROM")
+	}
+	if c.pc != 0x200 || c.sp != 0 || c.memory[0x200] != 0x12 {
+		t.Errorf("pc 0x%03X sp %d after a mismatch, want the ROM ready to run", c.pc, c.sp)
+	}
+
+	// No state is a fresh load
+	c = newTestChip8(t)
+	if err := c.LoadGameWithState(bytes.NewReader(callROM), nil); err != nil {
+		t.Fatal(err)
+	}
+	if c.pc != 0x200 || c.memory[0x200] != 0x22 {
+		t.Errorf("pc 0x%03X without a state, want the ROM loaded fresh", c.pc)
+	}
+}
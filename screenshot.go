@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+)
+
+// Screenshot writes the display at its current resolution as a PNG, each pixel scaled up to
+// a Config.ScreenshotScale square and coloured with Config.ScreenshotForeground or
+// Config.ScreenshotBackground.
+func (c *Chip8) Screenshot(w io.Writer) error {
+	scale := c.ScreenshotScale
+	if scale < 1 {
+		scale = 1
+	}
+	width, height := c.Width(), c.Height()
+
+	palette := color.Palette{c.ScreenshotBackground, c.ScreenshotForeground}
+	img := image.NewPaletted(image.Rect(0, 0, width*scale, height*scale), palette)
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			img.Pix[y*img.Stride+x] = c.gfx[(y/scale)*width+x/scale]
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// ScreenshotXBM writes the display at its current resolution as an X BitMap, a C source
+// fragment declaring the image as an array of bytes. Set pixels are 1 bits, and each byte
+// holds 8 pixels with the leftmost in the least significant bit, as the format requires.
+func (c *Chip8) ScreenshotXBM(w io.Writer) error {
+	width, height := c.Width(), c.Height()
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "#define chip8_width %d\n", width)
+	fmt.Fprintf(bw, "#define chip8_height %d\n", height)
+	fmt.Fprintf(bw, "static unsigned char chip8_bits[] = {")
+
+	n := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x += 8 {
+			var b byte
+			for bit := 0; bit < 8 && x+bit < width; bit++ {
+				if c.gfx[y*width+x+bit] == 1 {
+					b |= 1 << uint(bit)
+				}
+			}
+
+			if n > 0 {
+				bw.WriteString(",")
+			}
+			// 12 bytes to a line, like the files written by the bitmap tool
+			if n%12 == 0 {
+				bw.WriteString("\n   ")
+			} else {
+				bw.WriteString(" ")
+			}
+			fmt.Fprintf(bw, "0x%02x", b)
+			n++
+		}
+	}
+	bw.WriteString("};\n")
+	return bw.Flush()
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestScreenshot(t *testing.T) {
+	// LD V0, 10; LD V1, 3; LD V2, 1; LD F, V2; DRW V0, V1, 5: digit 1 at (10, 3)
+	c := newTestChip8(t, 0x60, 10, 0x61, 3, 0x62, 1, 0xF2, 0x29, 0xD0, 0x15)
+	step(t, c, 5)
+	c.ScreenshotScale = 2
+	fg, bg := color.RGBA{0xFF, 0x80, 0x00, 0xFF}, color.RGBA{0x00, 0x00, 0x40, 0xFF}
+	c.ScreenshotForeground, c.ScreenshotBackground = fg, bg
+
+	var buf bytes.Buffer
+	if err := c.Screenshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := img.Bounds().Size(); size != image.Pt(128, 64) {
+		t.Fatalf("screenshot is %v, want 128x64", size)
+	}
+
+	glyph := Chip8Fontset[5:10]
+	for y := 0; y < 64; y++ {
+		for x := 0; x < 128; x++ {
+			px, py := x/2-10, y/2-3
+			want := bg
+			if px >= 0 && px < 8 && py >= 0 && py < len(glyph) && glyph[py]>>(7-px)&1 == 1 {
+				want = fg
+			}
+			if got := color.RGBAModel.Convert(img.At(x, y)); got != want {
+				t.Fatalf("pixel (%d, %d) is %v, want %v", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestScreenshotXBM(t *testing.T) {
+	c := newTestChip8(t)
+	for _, i := range []int{0, 1, 9, 31*64 + 63} {
+		c.gfx[i] = 1
+	}
+	var buf bytes.Buffer
+	if err := c.ScreenshotXBM(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	header := "#define chip8_width 64\n#define chip8_height 32\nstatic unsigned char chip8_bits[] = {"
+	if !strings.HasPrefix(out, header) || !strings.HasSuffix(out, "};\n") {
+		t.Fatalf("XBM doesn't declare a 64x32 image:\n%s", out)
+	}
+	var bits []byte
+	for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(out, header), "};\n"), ",") {
+		b, err := strconv.ParseUint(strings.TrimSpace(field), 0, 8)
+		if err != nil {
+			t.Fatalf("bad byte %q: %v", field, err)
+		}
+		bits = append(bits, byte(b))
+	}
+
+	want := make([]byte, 64/8*32)
+	want[0], want[1], want[len(want)-1] = 0x03, 0x02, 0x80
+	if !bytes.Equal(bits, want) {
+		t.Errorf("bits % x, want % x", bits, want)
+	}
+}
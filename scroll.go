@@ -0,0 +1,30 @@
+package main
+
+// scrollDown moves the display down n rows, leaving blank rows at the top.
+func (c *Chip8) scrollDown(n int) {
+	c.scroll(0, n)
+}
+
+// scrollRight moves the display right n columns, or left if n is negative, leaving blank columns
+// behind.
+func (c *Chip8) scrollRight(n int) {
+	c.scroll(n, 0)
+}
+
+// scroll moves the display dx columns right and dy rows down, in pixels of the current
+// resolution. Anything moved off the edge is lost.
+func (c *Chip8) scroll(dx, dy int) {
+	c.recordDisplay()
+	width, height := c.Width(), c.Height()
+	old := c.gfx
+	c.gfx = [len(c.gfx)]byte{}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			fromX, fromY := x-dx, y-dy
+			if fromX >= 0 && fromX < width && fromY >= 0 && fromY < height {
+				c.gfx[y*width+x] = old[fromY*width+fromX]
+			}
+		}
+	}
+	c.redraw()
+}
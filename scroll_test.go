@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"image"
+	"reflect"
+	"testing"
+)
+
+// setPixels returns the pixels that are on, in display order.
+func setPixels(c *Chip8) []image.Point {
+	var pts []image.Point
+	width, height := c.Width(), c.Height()
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if c.gfx[y*width+x] != 0 {
+				pts = append(pts, image.Pt(x, y))
+			}
+		}
+	}
+	return pts
+}
+
+func TestScroll(t *testing.T) {
+	tests := []struct {
+		name   string
+		hires  bool
+		opcode uint16
+		want   []image.Point
+	}{
+		{"down 3", false, 0x00C3, []image.Point{{0, 3}, {10, 8}}},
+		{"down 0", false, 0x00C0, []image.Point{{0, 0}, {10, 5}, {63, 31}}},
+		{"right", false, 0x00FB, []image.Point{{4, 0}, {14, 5}}},
+		{"left", false, 0x00FC, []image.Point{{6, 5}, {59, 31}}},
+		{"hi-res down 2", true, 0x00C2, []image.Point{{0, 2}, {10, 7}, {123, 62}}},
+		{"hi-res right", true, 0x00FB, []image.Point{{4, 0}, {14, 5}, {127, 60}}},
+		{"hi-res left", true, 0x00FC, []image.Point{{6, 5}, {119, 60}, {123, 63}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newTestChip8(t, byte(tt.opcode>>8), byte(tt.opcode))
+			c.hires = tt.hires
+			width := c.Width()
+			for _, pt := range []image.Point{{0, 0}, {10, 5}, {width - 1, c.Height() - 1}} {
+				c.gfx[pt.Y*width+pt.X] = 1
+			}
+			if tt.hires {
+				c.gfx[60*width+123] = 1
+			}
+
+			step(t, c, 1)
+			if got := setPixels(c); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("0x%04X: pixels %v, want %v", tt.opcode, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSCHIPInstructionsNeedQuirk(t *testing.T) {
+	for _, opcode := range []uint16{0x00C1, 0x00FB, 0x00FC, 0x00FD, 0x00FE, 0x00FF, 0xF030, 0xF075, 0xF085} {
+		c := newTestChip8(t, byte(opcode>>8), byte(opcode))
+		c.SetAccuracy(AccuracyVIP)
+		var unknown unknownOpcodeError
+		if _, err := c.Step(); !errors.As(err, &unknown) {
+			t.Errorf("0x%04X on the VIP: error %v, want an unknown opcode", opcode, err)
+		}
+
+		c = newTestChip8(t, byte(opcode>>8), byte(opcode))
+		c.SetAccuracy(AccuracySCHIP)
+		if _, err := c.Step(); err != nil {
+			t.Errorf("0x%04X on SCHIP: %v", opcode, err)
+		}
+	}
+}
+
+func TestZeroHeightSprite(t *testing.T) {
+	tests := []struct {
+		name         string
+		hires        bool
+		largeSprites bool
+		want         int
+	}{
+		{"low-res", false, true, 0},
+		{"hi-res", true, true, 16 * 16},
+		{"hi-res without the quirk", true, false, 0},
+	}
+	for _, tt := range tests {
+		// LD I, 0x300; DRW V0, V0, 0
+		rom := []byte{0xA3, 0x00, 0xD0, 0x00}
+		if tt.hires {
+			rom = append([]byte{0x00, 0xFF}, rom...)
+		}
+		c := newTestChip8(t, rom...)
+		c.Quirks.LargeSprites = tt.largeSprites
+		for i := 0; i < 32; i++ {
+			c.memory[0x300+i] = 0xFF
+		}
+		step(t, c, len(rom)/2)
+		if got := len(setPixels(c)); got != tt.want {
+			t.Errorf("%s: DXY0 set %d pixels, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// StateText writes a plain text dump of the machine meant for pasting into bug reports: the
+// registers, timers, call stack and an ASCII picture of the display, with # for set pixels.
+func (c *Chip8) StateText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "registers:")
+	for row := 0; row < 4; row++ {
+		for col := 0; col < 4; col++ {
+			i := row*4 + col
+			if col > 0 {
+				bw.WriteString("  ")
+			}
+			fmt.Fprintf(bw, "V%X=%02X", i, c.V[i])
+		}
+		bw.WriteString("\n")
+	}
+	fmt.Fprintf(bw, "I=%03X  PC=%03X  SP=%X\n", c.I, c.pc, c.sp)
+	fmt.Fprintf(bw, "delay timer=%02X  sound timer=%02X\n", c.delayTimer, c.soundTimer)
+
+	fmt.Fprintln(bw, "stack:")
+	frames := c.StackFrames()
+	if len(frames) == 0 {
+		fmt.Fprintln(bw, "  empty")
+	}
+	for i := len(frames) - 1; i >= 0; i-- {
+		fmt.Fprintf(bw, "  #%d sub 0x%03X, returns to 0x%03X\n", i, frames[i].Entry, frames[i].Return)
+	}
+
+	width, height := c.Width(), c.Height()
+	fmt.Fprintf(bw, "screen (%dx%d):\n", width, height)
+	line := make([]byte, width)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if c.gfx[y*width+x] == 1 {
+				line[x] = '#'
+			} else {
+				line[x] = '.'
+			}
+		}
+		bw.Write(line)
+		bw.WriteString("\n")
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStateText(t *testing.T) {
+	// LD V3, 0xAB; CALL 0x206; (206) LD V0, 2; LD F, V0; DRW V0, V0, 5; JP 0x20E
+	c := newTestChip8(t, 0x63, 0xAB, 0x22, 0x06, 0x00, 0x00, 0x60, 0x02, 0xF0, 0x29, 0xD0, 0x05, 0x12, 0x0C)
+	step(t, c, 5)
+	var buf bytes.Buffer
+	if err := c.StateText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+
+	for _, want := range []string{
+		"registers:\nV0=02  V1=00  V2=00  V3=AB\n",
+		"VC=00  VD=00  VE=00  VF=00\n",
+		"I=00A  PC=20C  SP=1\n",
+		"stack:\n  #0 sub 0x206, returns to 0x204\n",
+		// The 2 drawn at (2, 2)
+		"screen (64x32):\n" + strings.Repeat(strings.Repeat(".", 64)+"\n", 2) +
+			"..####" + strings.Repeat(".", 58) + "\n" +
+			".....#" + strings.Repeat(".", 58) + "\n" +
+			"..####" + strings.Repeat(".", 58) + "\n" +
+			"..#..." + strings.Repeat(".", 58) + "\n" +
+			"..####" + strings.Repeat(".", 58) + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("state dump doesn't contain %q:\n%s", want, out)
+		}
+	}
+	// 5 lines of registers, the timers, 2 of stack, then the screen's heading and rows
+	if n, want := strings.Count(out, "\n"), 5+1+1+2+1+32; n != want {
+		t.Errorf("state dump is %d lines, want %d", n, want)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/nsf/termbox-go"
+)
+
+// frameStats measures the frame rate actually being achieved, for the status line.
+type frameStats struct {
+	windowStart  time.Time
+	windowFrames int
+	fps          float64
+
+	// What the status line last showed, so it's only redrawn when something changes
+	lastFrame  int
+	lastPaused bool
+}
+
+// DrawStats counts sprite draws between screen clears, to show how much redrawing a ROM does.
+// ROMs that clear and redraw everything every frame flicker the most.
+type DrawStats struct {
+	// Clears is the number of 00E0s executed
+	Clears int
+	// DrawsSinceClear is the number of DXYNs since the last 00E0, or since the start
+	DrawsSinceClear int
+	// DrawsBeforeLastClear is how many DXYNs there were between the last two 00E0s
+	DrawsBeforeLastClear int
+}
+
+func (s *DrawStats) clear() {
+	s.Clears++
+	s.DrawsBeforeLastClear = s.DrawsSinceClear
+	s.DrawsSinceClear = 0
+}
+
+// DrawStats returns the sprite drawing counts so far.
+func (c *Chip8) DrawStats() DrawStats {
+	return c.drawStats
+}
+
+// statusLine formats the status line shown below the display.
+func statusLine(name string, ipf int, fps float64, paused bool) string {
+	state := "running"
+	if paused {
+		state = "paused"
+	}
+	return fmt.Sprintf("%s | %d IPF | %.0f FPS | %s", name, ipf, fps, state)
+}
+
+// statusRow is the terminal row the status line is drawn on, below the display and keypad.
+func (c *Chip8) statusRow() int {
+	height := c.Height() * c.pixelScale(c.Width(), c.Height())
+	if c.ShowKeypad {
+		return height + 1 + keypadRows + 1
+	}
+	return height
+}
+
+// drawStatus renders the status line, cut short if the terminal is too narrow.
+func (c *Chip8) drawStatus() {
+	termWidth, termHeight := termbox.Size()
+	row := c.statusRow()
+	if row >= termHeight {
+		return
+	}
+
+	line := []rune(statusLine(c.Name, c.cyclesPerFrame(), c.stats.fps, c.Paused))
+	for x := 0; x < termWidth; x++ {
+		ch := ' '
+		if x < len(line) {
+			ch = line[x]
+		}
+		termbox.SetCell(x, row, ch, termbox.ColorDefault, termbox.ColorDefault)
+	}
+}
+
+// updateStatus keeps the frame rate up to date and asks for the status line to be redrawn once
+// per frame, or when the machine is paused or resumed.
+func (c *Chip8) updateStatus() {
+	now := time.Now()
+	frame := c.cycles / c.cyclesPerFrame()
+	s := &c.stats
+
+	if s.windowStart.IsZero() {
+		s.windowStart = now
+	}
+	if frame != s.lastFrame {
+		s.windowFrames++
+	}
+	if elapsed := now.Sub(s.windowStart); elapsed >= time.Second {
+		s.fps = float64(s.windowFrames) / elapsed.Seconds()
+		s.windowStart, s.windowFrames = now, 0
+	}
+
+	if !c.ShowStatus || (frame == s.lastFrame && c.Paused == s.lastPaused) {
+		return
+	}
+	s.lastFrame, s.lastPaused = frame, c.Paused
+	// The renderer draws the status line along with the display
+	c.drawFlag = true
+}
@@ -0,0 +1,70 @@
+package main
+
+import "testing"
+
+func TestStatusLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		ipf    int
+		fps    float64
+		paused bool
+		want   string
+	}{
+		{"PONG", 9, 59.7, false, "PONG | 9 IPF | 60 FPS | running"},
+		{"INVADERS", 15, 0, true, "INVADERS | 15 IPF | 0 FPS | paused"},
+	}
+	for _, tt := range tests {
+		if got := statusLine(tt.name, tt.ipf, tt.fps, tt.paused); got != tt.want {
+			t.Errorf("statusLine(%q, %d, %v, %v) = %q, want %q", tt.name, tt.ipf, tt.fps, tt.paused, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateStatusGoesThroughRenderer(t *testing.T) {
+	c := newTestChip8(t)
+	c.ShowStatus = true
+	c.updateStatus()
+	c.ClearDrawFlag()
+
+	// Nothing has changed, so there's nothing to redraw
+	c.updateStatus()
+	if c.ShouldDraw() {
+		t.Errorf("status redraw requested with nothing changed")
+	}
+
+	c.cycles += c.cyclesPerFrame()
+	c.updateStatus()
+	if !c.ShouldDraw() {
+		t.Errorf("no redraw requested for a new frame")
+	}
+	c.ClearDrawFlag()
+
+	c.Pause()
+	c.updateStatus()
+	if !c.ShouldDraw() {
+		t.Errorf("no redraw requested after pausing")
+	}
+	c.ClearDrawFlag()
+
+	c.ShowStatus = false
+	c.cycles += c.cyclesPerFrame()
+	c.updateStatus()
+	if c.ShouldDraw() {
+		t.Errorf("redraw requested with the status line hidden")
+	}
+}
+
+func TestDrawStats(t *testing.T) {
+	c := newTestChip8(t,
+		0x00, 0xE0, // 200: CLS
+		0xD0, 0x05, // 202: DRW V0, V0, 5
+		0xD0, 0x05, // 204: DRW V0, V0, 5
+		0x00, 0xE0, // 206: CLS
+		0xD0, 0x05, // 208: DRW V0, V0, 5
+	)
+	step(t, c, 5)
+	want := DrawStats{Clears: 2, DrawsSinceClear: 1, DrawsBeforeLastClear: 2}
+	if got := c.DrawStats(); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// toneSampleRate is the rate of the samples ToneRenderer writes, 8-bit unsigned mono
+	toneSampleRate = 22050
+	// toneHz is the pitch of the tone unless ToneRenderer.Hz says otherwise
+	toneHz = 440
+	// toneChunk is how much of the tone is written at a time
+	toneChunk = 10 * time.Millisecond
+)
+
+// squareWave generates an 8-bit unsigned square wave, carrying on from where the last Read left
+// off so there's no click between chunks.
+type squareWave struct {
+	rate, hz int
+	sample   int
+}
+
+func (w *squareWave) Read(p []byte) (int, error) {
+	period := w.rate / w.hz
+	if period < 2 {
+		period = 2
+	}
+	for i := range p {
+		if w.sample < period/2 {
+			p[i] = 0xC0
+		} else {
+			p[i] = 0x40
+		}
+		w.sample = (w.sample + 1) % period
+	}
+	return len(p), nil
+}
+
+// ToneRenderer is a Renderer that plays a square wave for as long as the sound timer runs,
+// writing the samples to Out as they're due: 8-bit unsigned mono at 22050Hz. Drawing is passed
+// on to Next, if it's set, but beeps aren't, as the tone replaces whatever Next does for them.
+type ToneRenderer struct {
+	Next Renderer
+	Out  io.Writer
+	// Hz is the pitch of the tone, 440 if it's zero
+	Hz int
+
+	mu      sync.Mutex
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+func (r *ToneRenderer) Draw(gfx []byte, width, height int) {
+	if r.Next != nil {
+		r.Next.Draw(gfx, width, height)
+	}
+}
+
+// Beep starts the tone when on is true and stops it when it's false. It returns once the tone
+// has stopped, so nothing more is written to Out after Beep(false).
+func (r *ToneRenderer) Beep(on bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !on {
+		if r.stop != nil {
+			close(r.stop)
+			<-r.stopped
+			r.stop, r.stopped = nil, nil
+		}
+		return
+	}
+	if r.stop != nil {
+		return
+	}
+
+	hz := r.Hz
+	if hz <= 0 {
+		hz = toneHz
+	}
+	r.stop, r.stopped = make(chan struct{}), make(chan struct{})
+	go r.play(&squareWave{rate: toneSampleRate, hz: hz}, r.stop, r.stopped)
+}
+
+// play writes a chunk of wave to Out every toneChunk until stop is closed, or Out fails.
+func (r *ToneRenderer) play(wave *squareWave, stop <-chan struct{}, stopped chan<- struct{}) {
+	defer close(stopped)
+
+	chunk := make([]byte, toneSampleRate*int(toneChunk)/int(time.Second))
+	ticker := time.NewTicker(toneChunk)
+	defer ticker.Stop()
+	for {
+		wave.Read(chunk)
+		if _, err := r.Out.Write(chunk); err != nil {
+			return
+		}
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// StartAplay starts aplay, from ALSA, playing the samples written to the returned writer. The
+// caller closes the writer to stop it.
+func StartAplay() (io.WriteCloser, error) {
+	cmd := exec.Command("aplay", "-q", "-t", "raw", "-f", "U8", "-c", "1", "-r", strconv.Itoa(toneSampleRate))
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &aplayWriter{WriteCloser: w, cmd: cmd}, nil
+}
+
+// aplayWriter waits for aplay to exit once it's been closed.
+type aplayWriter struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (w *aplayWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if werr := w.cmd.Wait(); err == nil {
+		err = werr
+	}
+	return err
+}
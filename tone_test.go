@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSquareWave(t *testing.T) {
+	w := &squareWave{rate: 8, hz: 2}
+	// Split across reads, so the phase has to carry over
+	a, b := make([]byte, 3), make([]byte, 7)
+	w.Read(a)
+	w.Read(b)
+	want := []byte{0xC0, 0xC0, 0x40, 0x40, 0xC0, 0xC0, 0x40, 0x40, 0xC0, 0xC0}
+	if got := append(a, b...); !bytes.Equal(got, want) {
+		t.Errorf("got % X, want % X", got, want)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer that's safe to write from the tone's goroutine.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Len()
+}
+
+func TestToneLastsAsLongAsTheSoundTimer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("runs in real time")
+	}
+	out := &lockedBuffer{}
+	next := &HeadlessRenderer{}
+	r := &ToneRenderer{Next: next, Out: out}
+
+	// LD V0, 15; LD ST, V0: a quarter of a second of tone; DRW V0, V0, 5; then spin
+	c := newTestChip8(t, 0x60, 0x0F, 0xF0, 0x18, 0xD0, 0x05, 0x12, 0x06)
+	c.Renderer = r
+	emulate(t, c, 20*c.cyclesPerFrame())
+	if c.soundTimer != 0 {
+		t.Fatalf("sound timer still at %d", c.soundTimer)
+	}
+
+	// It was playing the whole time, then stopped
+	n := out.Len()
+	if min := toneSampleRate / 5; n < min {
+		t.Errorf("%d samples of tone for a quarter of a second, want at least %d", n, min)
+	}
+	time.Sleep(3 * toneChunk)
+	if out.Len() != n {
+		t.Errorf("the tone carried on after the sound timer ran out")
+	}
+	if len(next.Beeps) != 0 || next.Frame == nil {
+		t.Errorf("passed on beeps %v and frame %v, want just the drawing", next.Beeps, next.Frame != nil)
+	}
+}
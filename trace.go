@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// TraceEntry is one instruction in the trace of recently executed instructions, see
+// Config.TraceDepth.
+type TraceEntry struct {
+	PC     uint16
+	Opcode uint16
+}
+
+// traceRing holds the most recent instructions, overwriting the oldest once it's full.
+type traceRing struct {
+	entries []TraceEntry
+	next    int
+	full    bool
+}
+
+// add records e in a ring of depth entries. The ring starts again if depth has changed, and
+// records nothing if it's zero.
+func (r *traceRing) add(depth int, e TraceEntry) {
+	if depth <= 0 {
+		return
+	}
+	if len(r.entries) != depth {
+		*r = traceRing{entries: make([]TraceEntry, depth)}
+	}
+
+	r.entries[r.next] = e
+	r.next = (r.next + 1) % depth
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// list returns a copy of the entries, oldest first.
+func (r *traceRing) list() []TraceEntry {
+	if !r.full {
+		return append([]TraceEntry(nil), r.entries[:r.next]...)
+	}
+	return append(append([]TraceEntry(nil), r.entries[r.next:]...), r.entries[:r.next]...)
+}
+
+// Trace returns up to the last Config.TraceDepth instructions executed, oldest first. The last
+// entry is the instruction that failed, if one has.
+func (c *Chip8) Trace() []TraceEntry {
+	return c.trace.list()
+}
+
+// dumpTrace logs err along with the instructions leading up to it.
+func (c *Chip8) dumpTrace(err error) {
+	entries := c.Trace()
+	if len(entries) == 0 {
+		return
+	}
+
+	c.warnf("%v; the last %d instructions were:", err, len(entries))
+	for _, e := range entries {
+		asm, _ := Mnemonic(e.Opcode)
+		c.warnf("  0x%03X: %04X    %s", e.PC, e.Opcode, asm)
+	}
+}
+
+// WriterTracer returns a Chip8.Tracer that writes each instruction to w on a line of its own,
+// in the same format the debugger uses.
+func WriterTracer(w io.Writer) func(pc, opcode uint16, mnemonic string) {
+	return func(pc, opcode uint16, mnemonic string) {
+		fmt.Fprintf(w, "0x%03X: %04X    %s\n", pc, opcode, mnemonic)
+	}
+}
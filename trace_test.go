@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"testing"
+)
+
+func TestTraceDumpedOnError(t *testing.T) {
+	c := newTestChip8(t,
+		0x60, 0x01, // 200: LD V0, 0x01
+		0x61, 0x02, // 202: LD V1, 0x02
+		0x80, 0x14, // 204: ADD V0, V1
+		0x50, 0x01, // 206: not an instruction
+	)
+	c.TraceDepth = 3
+	var logged bytes.Buffer
+	c.Log = log.New(&logged, "", 0)
+
+	for i := 0; i < 3; i++ {
+		if err := c.cycle(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.cycle(); err == nil {
+		t.Fatal("0x5001 ran, want it to fail")
+	}
+
+	// The oldest instruction has dropped out of the ring
+	want := "unknown opcode: 0x5001; the last 3 instructions were:\n" +
+		"  0x202: 6102    LD V[1], 0x02\n" +
+		"  0x204: 8014    ADD V[0], V[1]\n" +
+		"  0x206: 5001    DW 0x5001\n"
+	if got := logged.String(); got != want {
+		t.Errorf("got\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestTracer(t *testing.T) {
+	// LD V0, 1; CALL 0x206; JP 0x204; RET
+	c := newTestChip8(t, 0x60, 0x01, 0x22, 0x06, 0x12, 0x04, 0x00, 0xEE)
+	type traced struct {
+		pc, opcode uint16
+		mnemonic   string
+	}
+	var got []traced
+	c.Tracer = func(pc, opcode uint16, mnemonic string) { got = append(got, traced{pc, opcode, mnemonic}) }
+	step(t, c, 4)
+
+	want := []traced{
+		{0x200, 0x6001, "LD V[0], 0x01"},
+		{0x202, 0x2206, "CALL 0x206"},
+		{0x206, 0x00EE, "RET"},
+		{0x204, 0x1204, "JP 0x204"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("traced %v, want %v", got, want)
+	}
+
+	var buf bytes.Buffer
+	c = newTestChip8(t, 0x60, 0x01, 0x12, 0x02)
+	c.Tracer = WriterTracer(&buf)
+	step(t, c, 2)
+	if want := "0x200: 6001    LD V[0], 0x01\n0x202: 1202    JP 0x202\n"; buf.String() != want {
+		t.Errorf("WriterTracer wrote %q, want %q", buf.String(), want)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import "fmt"
+
+// undoState is the part of the machine that's cheap enough to copy before every instruction.
+// Memory and the display are too big, so only the parts that change are logged.
+type undoState struct {
+	opcode, I, pc, sp uint16
+	V                 [16]byte
+	stack             [16]uint16
+	callTargets       [16]uint16
+
+	delayTimer, lastDelayTimer, soundTimer uint8
+	keys, prevKeys                         [16]bool
+
+	hires, halted, waitingForFrame, drewThisFrame bool
+	cycles, framesWithoutDraw                     int
+	delayZeroReads, delaySpinFrames               int
+	delayRunning                                  bool
+}
+
+type memoryUndo struct {
+	addr uint16
+	old  byte
+}
+
+type pixelUndo struct {
+	idx uint16
+	old byte
+}
+
+// undoRecord holds everything needed to reverse one instruction.
+type undoRecord struct {
+	state  undoState
+	memory []memoryUndo
+	pixels []pixelUndo
+	// display is a copy of the whole framebuffer, for instructions that change all of it
+	display *[hiResWidth * hiResHeight]byte
+	// bank is the bank that was mapped in, if the instruction switched banks
+	bank         int
+	switchedBank bool
+	// rpl is what the loaded ROM's RPL user flags were, if the instruction changed them, and
+	// hadRPL whether it had any
+	rpl                [16]byte
+	changedRPL, hadRPL bool
+}
+
+func (c *Chip8) saveUndoState() undoState {
+	return undoState{
+		opcode: c.opcode, I: c.I, pc: c.pc, sp: c.sp,
+		V: c.V, stack: c.stack, callTargets: c.callTargets,
+		delayTimer: c.delayTimer, lastDelayTimer: c.lastDelayTimer, soundTimer: c.soundTimer,
+		keys: c.keys, prevKeys: c.prevKeys,
+		hires: c.hires, halted: c.halted, waitingForFrame: c.waitingForFrame, drewThisFrame: c.drewThisFrame,
+		cycles: c.cycles, framesWithoutDraw: c.framesWithoutDraw,
+		delayZeroReads: c.delayZeroReads, delaySpinFrames: c.delaySpinFrames, delayRunning: c.delayRunning,
+	}
+}
+
+func (c *Chip8) restoreUndoState(s undoState) {
+	c.opcode, c.I, c.pc, c.sp = s.opcode, s.I, s.pc, s.sp
+	c.V, c.stack, c.callTargets = s.V, s.stack, s.callTargets
+	c.delayTimer, c.lastDelayTimer, c.soundTimer = s.delayTimer, s.lastDelayTimer, s.soundTimer
+	c.keys, c.prevKeys = s.keys, s.prevKeys
+	c.hires, c.halted, c.waitingForFrame, c.drewThisFrame = s.hires, s.halted, s.waitingForFrame, s.drewThisFrame
+	c.cycles, c.framesWithoutDraw = s.cycles, s.framesWithoutDraw
+	c.delayZeroReads, c.delaySpinFrames, c.delayRunning = s.delayZeroReads, s.delaySpinFrames, s.delayRunning
+}
+
+// beginUndo starts logging the changes made by the next instruction, with Config.UndoDepth.
+func (c *Chip8) beginUndo() {
+	if c.UndoDepth <= 0 {
+		return
+	}
+	if len(c.undoLog) >= c.UndoDepth {
+		c.undoLog = c.undoLog[len(c.undoLog)-c.UndoDepth+1:]
+	}
+	c.undoLog = append(c.undoLog, &undoRecord{state: c.saveUndoState()})
+}
+
+// dropUndo forgets the record begun for an instruction that didn't run after all.
+func (c *Chip8) dropUndo() {
+	if c.UndoDepth > 0 && len(c.undoLog) > 0 {
+		c.undoLog = c.undoLog[:len(c.undoLog)-1]
+	}
+}
+
+// currentUndo is the record for the instruction being executed, or nil if nothing is logged.
+func (c *Chip8) currentUndo() *undoRecord {
+	if c.UndoDepth <= 0 || len(c.undoLog) == 0 {
+		return nil
+	}
+	return c.undoLog[len(c.undoLog)-1]
+}
+
+func (c *Chip8) recordMemory(addr uint16) {
+	if r := c.currentUndo(); r != nil {
+		r.memory = append(r.memory, memoryUndo{addr, c.memory[addr]})
+	}
+}
+
+func (c *Chip8) recordPixel(idx uint16) {
+	if r := c.currentUndo(); r != nil && r.display == nil {
+		r.pixels = append(r.pixels, pixelUndo{idx, c.gfx[idx]})
+	}
+}
+
+func (c *Chip8) recordDisplay() {
+	if r := c.currentUndo(); r != nil && r.display == nil {
+		display := c.gfx
+		r.display = &display
+	}
+}
+
+func (c *Chip8) recordBank() {
+	if r := c.currentUndo(); r != nil && !r.switchedBank {
+		r.bank, r.switchedBank = c.bank, true
+	}
+}
+
+func (c *Chip8) recordRPL() {
+	if r := c.currentUndo(); r != nil && !r.changedRPL {
+		flags, ok := c.rplStore[c.romHash]
+		r.rpl, r.hadRPL, r.changedRPL = flags, ok, true
+	}
+}
+
+// StepBackOne reverses the last instruction executed, restoring everything it changed. How
+// many instructions can be reversed is set by Config.UndoDepth.
+func (c *Chip8) StepBackOne() error {
+	if len(c.undoLog) == 0 {
+		return fmt.Errorf("there's no instruction to step back over")
+	}
+	r := c.undoLog[len(c.undoLog)-1]
+	c.undoLog = c.undoLog[:len(c.undoLog)-1]
+
+	// Put everything back in the opposite order it changed in
+	for i := len(r.pixels) - 1; i >= 0; i-- {
+		c.gfx[r.pixels[i].idx] = r.pixels[i].old
+	}
+	if r.display != nil {
+		c.gfx = *r.display
+	}
+	for i := len(r.memory) - 1; i >= 0; i-- {
+		c.memory[r.memory[i].addr] = r.memory[i].old
+	}
+	if r.switchedBank {
+		// Not switchBank, which would log the switch in the record below this one
+		c.mapBank(r.bank)
+	}
+	if r.changedRPL {
+		if r.hadRPL {
+			c.rplStore[c.romHash] = r.rpl
+		} else {
+			delete(c.rplStore, c.romHash)
+		}
+	}
+	c.restoreUndoState(r.state)
+	c.fault = nil
+	c.drawFlag = true
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestStepBackOneRestoresEachInstruction(t *testing.T) {
+	c := newTestChip8(t,
+		0x60, 0x05, // 0x200: LD V0, 0x05
+		0x70, 0x03, // 0x202: ADD V0, 0x03
+		0xA3, 0x00, // 0x204: LD I, 0x300
+		0xF0, 0x33, // 0x206: LD B, V0
+		0xD0, 0x15, // 0x208: DRW V0, V1, 5
+		0x22, 0x14, // 0x20A: CALL 0x214
+		0xF0, 0x15, // 0x20C: LD DT, V0
+		0x00, 0xE0, // 0x20E: CLS
+		0xF1, 0x75, // 0x210: LD R, V1
+		0x12, 0x12, // 0x212: JP 0x212
+		0x81, 0x04, // 0x214: ADD V1, V0
+		0x00, 0xEE, // 0x216: RET
+	)
+	c.UndoDepth = 20
+
+	var before [][]byte
+	for i := 0; i < 12; i++ {
+		before = append(before, c.SaveState())
+		step(t, c, 1)
+	}
+	for i := len(before) - 1; i >= 0; i-- {
+		if err := c.StepBackOne(); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(c.SaveState(), before[i]) {
+			t.Fatalf("state after stepping back to instruction %d doesn't match the state before it ran", i+1)
+		}
+	}
+	if _, ok := c.rplStore[c.romHash]; ok {
+		t.Errorf("RPL flags still set after stepping back over FX75")
+	}
+	if err := c.StepBackOne(); err == nil {
+		t.Errorf("StepBackOne with nothing left to undo returned no error")
+	}
+}
+
+func TestStepBackOneOverBankSwitch(t *testing.T) {
+	// An 8KB image
+	rom := make([]byte, 0x2000-0x200)
+	copy(rom, []byte{0x60, 0x01, 0x01, 0x01, 0x60, 0x02})
+	for i := 6; i < len(rom); i++ {
+		rom[i] = byte(i / 7)
+	}
+
+	c := NewChip8()
+	c.Renderer = NullRenderer{}
+	c.Keypad = nil
+	c.BankSwitching = true
+	c.UndoDepth = 10
+	c.Initialize()
+	if err := c.LoadGameBytes(rom); err != nil {
+		t.Fatal(err)
+	}
+	mapped := c.memory
+
+	step(t, c, 3)
+	if c.bank != 1 {
+		t.Fatalf("bank %d mapped after 0101, want 1", c.bank)
+	}
+	for i := 0; i < 3; i++ {
+		if err := c.StepBackOne(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.pc != 0x200 || c.bank != 0 || c.memory != mapped {
+		t.Errorf("after stepping back to the start pc is 0x%03X with bank %d mapped, want 0x200 with the original bank 0", c.pc, c.bank)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// WatchRegister calls cb whenever an instruction changes register VX, with its value before
+// and after. Watches only see changes made by the running program.
+func (c *Chip8) WatchRegister(x int, cb func(old, new byte)) error {
+	if x < 0 || x >= len(c.V) {
+		return fmt.Errorf("register %d is out of range, there are only V0 to VF", x)
+	}
+	c.registerWatches[x] = append(c.registerWatches[x], cb)
+	c.watchingRegisters = true
+	return nil
+}
+
+// WatchMemory calls cb whenever an instruction changes the byte of memory at addr, with its
+// value before and after.
+func (c *Chip8) WatchMemory(addr uint16, cb func(old, new byte)) error {
+	if int(addr) >= len(c.memory) {
+		return fmt.Errorf("address 0x%X is out of range", addr)
+	}
+	if c.memoryWatches == nil {
+		c.memoryWatches = make(map[uint16][]func(old, new byte))
+	}
+	c.memoryWatches[addr] = append(c.memoryWatches[addr], cb)
+	return nil
+}
+
+// ClearWatches removes all register and memory watches.
+func (c *Chip8) ClearWatches() {
+	c.registerWatches = [16][]func(old, new byte){}
+	c.watchingRegisters = false
+	c.memoryWatches = nil
+}
+
+// checkRegisterWatches calls the watches on each register that's changed from before.
+func (c *Chip8) checkRegisterWatches(before [16]byte) {
+	for x, cbs := range c.registerWatches {
+		if before[x] == c.V[x] {
+			continue
+		}
+		for _, cb := range cbs {
+			cb(before[x], c.V[x])
+		}
+	}
+}
+
+// checkMemoryWatch calls the watches on addr if b changes it.
+func (c *Chip8) checkMemoryWatch(addr uint16, b byte) {
+	if old := c.memory[addr]; old != b {
+		for _, cb := range c.memoryWatches[addr] {
+			cb(old, b)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// change is one call to a watch.
+type change struct{ old, new byte }
+
+func TestWatchRegister(t *testing.T) {
+	// LD V0, 5; LD V0, 5; ADD V0, 1; LD V1, 9
+	c := newTestChip8(t, 0x60, 0x05, 0x60, 0x05, 0x70, 0x01, 0x61, 0x09)
+	var changes []change
+	if err := c.WatchRegister(0, func(old, new byte) { changes = append(changes, change{old, new}) }); err != nil {
+		t.Fatal(err)
+	}
+
+	step(t, c, 1)
+	if want := []change{{0, 5}}; !reflect.DeepEqual(changes, want) {
+		t.Fatalf("got changes %v after 6005, want %v", changes, want)
+	}
+	// Setting it to the value it already has, and changing another register, aren't changes
+	step(t, c, 3)
+	if want := []change{{0, 5}, {5, 6}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+
+	if err := c.WatchRegister(16, func(old, new byte) {}); err == nil {
+		t.Error("watched V16")
+	}
+}
+
+func TestWatchMemory(t *testing.T) {
+	// LD V0, 7; LD I, 0x300; LD [I], V0; LD B, V0
+	c := newTestChip8(t, 0x60, 0x07, 0xA3, 0x00, 0xF0, 0x55, 0xF0, 0x33)
+	c.Quirks.LoadStoreIncrementsI = false
+	var changes []change
+	if err := c.WatchMemory(0x300, func(old, new byte) { changes = append(changes, change{old, new}) }); err != nil {
+		t.Fatal(err)
+	}
+	step(t, c, 4)
+	// FX55 stores 7, then the hundreds digit of the BCD puts it back to 0
+	if want := []change{{0, 7}, {7, 0}}; !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %v, want %v", changes, want)
+	}
+}